@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// pcmDecoder decodes an mp3 stream to stereo samples.
+type pcmDecoder struct {
+	*mp3.Decoder
+}
+
+func newPcmDecoder(r io.Reader) (pcmDecoder, error) {
+	decoder, err := mp3.NewDecoder(r)
+	return pcmDecoder{decoder}, err
+}
+
+// each calls sample for every stereo sample, scaled to [-1, 1).
+func (d pcmDecoder) each(sample func(left, right float64)) error {
+	return eachSample(d.Decoder, sample)
+}
+
+// eachSample calls sample for every stereo sample of decoded pcm.
+func eachSample(pcm io.Reader, sample func(left, right float64)) error {
+	// The decoder always yields interleaved 16 bit little endian stereo.
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := io.ReadFull(pcm, buf)
+		for i := 0; i+4 <= n; i += 4 {
+			left := float64(int16(binary.LittleEndian.Uint16(buf[i:]))) / 32768
+			right := float64(int16(binary.LittleEndian.Uint16(buf[i+2:]))) / 32768
+			sample(left, right)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// openStream requests a loopstream url like the downloads do and decodes the
+// response. The caller closes the returned body.
+func openStream(url string) (pcmDecoder, io.Closer, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return pcmDecoder{}, nil, err
+	}
+	req.Header.Set("Referer", "https://sound.orf.at/")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return pcmDecoder{}, nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return pcmDecoder{}, nil, fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	decoder, err := newPcmDecoder(bufio.NewReader(throttledReader{resp.Body}))
+	if err != nil {
+		_ = resp.Body.Close()
+		return pcmDecoder{}, nil, err
+	}
+	return decoder, resp.Body, nil
+}
@@ -47,6 +47,9 @@ type Broadcast struct {
 	Items                []Items       `json:"items"`
 	Streams              []Streams     `json:"streams"`
 	Marks                []Marks       `json:"marks"`
+	// Expiry is when the broadcast leaves the on-demand window. Populated from
+	// the v5.0 payload by toBroadcast; not present in the v4.0 JSON.
+	Expiry time.Time `json:"-"`
 }
 type Versions struct {
 	Path     string `json:"path"`
@@ -83,6 +86,7 @@ type Items struct {
 	IsAdFree       bool          `json:"isAdFree"`
 	Title          string        `json:"title,omitempty"`
 	Subtitle       string        `json:"subtitle,omitempty"`
+	Interpreter    string        `json:"interpreter,omitempty"`
 	Moderator      string        `json:"moderator,omitempty"`
 	Start          int64         `json:"start"`
 	StartISO       time.Time     `json:"startISO"`
@@ -152,12 +156,13 @@ type streamV5 struct {
 }
 
 type itemV5 struct {
-	Type     string `json:"type"`
-	Title    string `json:"title,omitempty"`
-	Subtitle string `json:"subtitle,omitempty"`
-	Start    string `json:"start"` // ISO
-	End      string `json:"end"`   // ISO
-	Duration int    `json:"duration"`
+	Type        string `json:"type"`
+	Title       string `json:"title,omitempty"`
+	Subtitle    string `json:"subtitle,omitempty"`
+	Interpreter string `json:"interpreter,omitempty"`
+	Start       string `json:"start"` // ISO
+	End         string `json:"end"`   // ISO
+	Duration    int    `json:"duration"`
 }
 
 type broadcastV5 struct {
@@ -177,6 +182,7 @@ type broadcastV5 struct {
 	Start          string     `json:"start"` // ISO
 	End            string     `json:"end"`   // ISO
 	Duration       int        `json:"duration"`
+	Expiry         string     `json:"expiry"` // ISO
 	Images         []Images   `json:"images"`
 	Streams        []streamV5 `json:"streams"`
 	Items          []itemV5   `json:"items"`
@@ -194,12 +200,13 @@ func (b broadcastV5) toBroadcast() Broadcast {
 	items := make([]Items, 0, len(b.Items))
 	for _, it := range b.Items {
 		items = append(items, Items{
-			Type:     it.Type,
-			Title:    it.Title,
-			Subtitle: it.Subtitle,
-			Start:    isoToMs(it.Start),
-			End:      isoToMs(it.End),
-			Duration: it.Duration,
+			Type:        it.Type,
+			Title:       it.Title,
+			Subtitle:    it.Subtitle,
+			Interpreter: it.Interpreter,
+			Start:       isoToMs(it.Start),
+			End:         isoToMs(it.End),
+			Duration:    it.Duration,
 		})
 	}
 
@@ -236,12 +243,24 @@ func (b broadcastV5) toBroadcast() Broadcast {
 		End:            endMs,
 		StartISO:       startISO,
 		EndISO:         endISO,
+		Expiry:         isoToTime(b.Expiry),
 		Images:         b.Images,
 		Streams:        streams,
 		Items:          items,
 	}
 }
 
+// toSummary maps the v5.0 payload into a broadcastSummary. Episode list
+// entries may come without start/end, so the payload's own duration is used
+// when the range does not provide one.
+func (b broadcastV5) toSummary() broadcastSummary {
+	summary := b.toBroadcast().toSummary()
+	if summary.Duration == 0 {
+		summary.Duration = int64(b.Duration)
+	}
+	return summary
+}
+
 // isoToTime parses an ORF v5.0 ISO-8601 timestamp (e.g.
 // "2026-06-20T16:59:36.000Z"). Returns the zero time on failure; callers that
 // branch on "" guard the empty case.
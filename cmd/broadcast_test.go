@@ -56,6 +56,14 @@ func TestGetBroadcastV5Mapping(t *testing.T) {
 		t.Errorf("stream duration got %d want %d", got, wantDuration)
 	}
 
+	// Only the second Davidecks item names its interpreter.
+	if got := broadcast.Items[3].Interpreter; got != "David Dunne" {
+		t.Errorf("item interpreter got %q want %q", got, "David Dunne")
+	}
+	if got := broadcast.Items[1].Interpreter; got != "" {
+		t.Errorf("item interpreter got %q want none", got)
+	}
+
 	got := contentSegments(show)
 	want := []segment{
 		{offset: 248500, offsetEnd: 3561000},  // after the leading news, up to the first ad
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiHost is the host of the ORF audio API, whose responses are cached.
+const apiHost = "audioapi.orf.at"
+
+// apiCache is the on-disk cache of audioapi responses shared by every request
+// of the process. The zero value caches nothing.
+type apiCache struct {
+	mu sync.Mutex
+
+	// dir is where the responses are stored; "" disables the cache.
+	dir string
+	// completedTTL is how long a completed broadcast (state "C"), whose
+	// metadata does not change anymore, is served without asking ORF.
+	completedTTL time.Duration
+	// offline answers every request from the cache and fails on a miss.
+	offline bool
+	// readOnly answers from the cache but never writes it, for dry runs.
+	readOnly bool
+}
+
+var responseCache = &apiCache{}
+
+// configure applies the cache settings of a run.
+func (c *apiCache) configure(dir string, completedTTL time.Duration, offline bool, readOnly bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dir = dir
+	c.completedTTL = completedTTL
+	c.offline = offline
+	c.readOnly = readOnly
+}
+
+func (c *apiCache) settings() (dir string, completedTTL time.Duration, offline bool, readOnly bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dir, c.completedTTL, c.offline, c.readOnly
+}
+
+// cacheEntry is a cached response as stored on disk.
+type cacheEntry struct {
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	// Stored is when the response was fetched or last revalidated.
+	Stored    time.Time `json:"stored"`
+	Completed bool      `json:"completed,omitempty"`
+}
+
+// fresh reports whether the entry may be served without asking ORF: a
+// completed broadcast within the TTL, otherwise as Cache-Control or Expires
+// allow.
+func (e cacheEntry) fresh(completedTTL time.Duration) bool {
+	age := now().Sub(e.Stored)
+	if e.Completed && completedTTL > 0 {
+		return age < completedTTL
+	}
+	directives := cacheControl(e.Header)
+	if _, ok := directives["no-cache"]; ok {
+		return false
+	}
+	if maxAge, ok := directives["max-age"]; ok {
+		seconds, err := strconv.Atoi(maxAge)
+		return err == nil && age < time.Duration(seconds)*time.Second
+	}
+	if expires, err := http.ParseTime(e.Header.Get("Expires")); err == nil {
+		return now().Before(expires)
+	}
+	return false
+}
+
+func (e cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// cacheControl parses the Cache-Control directives of a response.
+func cacheControl(header http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(trim(directive), "=")
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+// completedBroadcast reports whether a response is a broadcast in state "C",
+// which ORF does not change anymore.
+func completedBroadcast(body []byte) bool {
+	var wrapper struct {
+		Payload json.RawMessage `json:"payload"`
+	}
+	var broadcast struct {
+		State string `json:"state"`
+	}
+	return json.Unmarshal(body, &wrapper) == nil &&
+		json.Unmarshal(wrapper.Payload, &broadcast) == nil &&
+		broadcast.State == "C"
+}
+
+func cachePath(dir string, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".json")
+}
+
+func loadCacheEntry(path string) (cacheEntry, bool) {
+	var entry cacheEntry
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entry, false
+	}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		slog.Warn("Ignoring a broken cache entry", "path", path, "error", err)
+		return entry, false
+	}
+	return entry, true
+}
+
+// storeCacheEntry writes the entry to a temporary file first, so concurrent
+// readers never see half of it.
+func storeCacheEntry(path string, entry cacheEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := makeDirectoryIfNotExisting(filepath.Dir(path)); err != nil {
+		return err
+	}
+	partPath := fmt.Sprintf("%s.%d.part", path, os.Getpid())
+	if err := os.WriteFile(partPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(partPath, path)
+}
+
+// pruneCache removes the entries not fetched or revalidated within maxAge, such
+// as broadcasts that left the on-demand window long ago, and returns how many
+// were removed.
+func pruneCache(dir string, maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || !info.Mode().IsRegular() || now().Sub(info.ModTime()) < maxAge {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, e.Name())); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// cacheTransport answers audioapi GET requests from the cache while they are
+// fresh and revalidates them with their ETag and Last-Modified once they are
+// stale. Cache hits neither wait for the request delay nor count as requests
+// in the metrics.
+type cacheTransport struct {
+	next http.RoundTripper
+}
+
+func (t cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	dir, completedTTL, offline, readOnly := responseCache.settings()
+	if dir == "" || req.Method != http.MethodGet || req.URL.Host != apiHost {
+		if offline {
+			return nil, fmt.Errorf("offline mode, not fetching %s", req.URL)
+		}
+		return t.next.RoundTrip(req)
+	}
+
+	path := cachePath(dir, req.URL.String())
+	entry, cached := loadCacheEntry(path)
+	if cached && (offline || entry.fresh(completedTTL)) {
+		slog.Debug("Answered from the cache", "url", req.URL)
+		return entry.response(req), nil
+	}
+	if offline {
+		return nil, fmt.Errorf("offline mode, %s is not in the cache", req.URL)
+	}
+
+	if cached {
+		req = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); lastModified != "" {
+			req.Header.Set("If-Modified-Since", lastModified)
+		}
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached && resp.StatusCode == http.StatusNotModified {
+		_ = resp.Body.Close()
+		slog.Debug("Revalidated the cached response", "url", req.URL)
+		for _, name := range []string{"Cache-Control", "Expires", "ETag", "Last-Modified"} {
+			if value := resp.Header.Get(name); value != "" {
+				entry.Header.Set(name, value)
+			}
+		}
+		entry.Stored = now()
+		if readOnly {
+			return entry.response(req), nil
+		}
+		if err := storeCacheEntry(path, entry); err != nil {
+			slog.Warn("Could not update the cache", "url", req.URL, "error", err)
+		}
+		return entry.response(req), nil
+	}
+	if _, noStore := cacheControl(resp.Header)["no-store"]; resp.StatusCode != http.StatusOK || noStore || readOnly {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	entry = cacheEntry{
+		URL:       req.URL.String(),
+		Status:    resp.StatusCode,
+		Header:    resp.Header.Clone(),
+		Body:      body,
+		Stored:    now(),
+		Completed: completedBroadcast(body),
+	}
+	if err := storeCacheEntry(path, entry); err != nil {
+		slog.Warn("Could not write to the cache", "url", req.URL, "error", err)
+	}
+	return resp, nil
+}
+
+// cacheFlags registers the response cache flags on a subcommand.
+type cacheFlags struct {
+	dir     *string
+	ttl     *time.Duration
+	maxAge  *time.Duration
+	offline *bool
+}
+
+func addCacheFlags(fs *flag.FlagSet) *cacheFlags {
+	return &cacheFlags{
+		dir:     fs.String("cache-dir", "", "Cache the audioapi responses in this directory"),
+		ttl:     fs.Duration("cache-ttl", 30*24*time.Hour, "Serve completed broadcasts from the cache this long without asking ORF"),
+		maxAge:  fs.Duration("cache-max-age", 90*24*time.Hour, "Remove cached responses not refreshed this long; 0 keeps them forever"),
+		offline: fs.Bool("offline", false, "Answer API requests from the cache only; needs -cache-dir"),
+	}
+}
+
+// setup applies the parsed cache flags and prunes the cache. Offline runs
+// keep every entry, they have nothing to replace them with. A dry run reads
+// the cache but neither prunes nor writes it.
+func (f *cacheFlags) setup(dryRun bool) {
+	if *f.offline && *f.dir == "" {
+		fatal("-offline needs a -cache-dir to answer from")
+	}
+	responseCache.configure(*f.dir, *f.ttl, *f.offline, dryRun)
+	if *f.dir != "" && *f.maxAge > 0 && !*f.offline && !dryRun {
+		removed, err := pruneCache(*f.dir, *f.maxAge)
+		if err != nil {
+			slog.Warn("Could not prune the cache", "dir", *f.dir, "error", err)
+		} else if removed > 0 {
+			slog.Debug("Pruned the cache", "dir", *f.dir, "removed", removed)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func fetch(t *testing.T, url string) (string, error) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), nil
+}
+
+func TestCacheTransport(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	defer responseCache.configure("", 0, false, false)
+	responseCache.configure(t.TempDir(), 24*time.Hour, false, false)
+	defer func(f func() time.Time) { now = f }(now)
+	clock := time.Date(2026, 6, 21, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	completed := "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628?items=1000"
+	httpmock.RegisterResponder("GET", completed, func(req *http.Request) (*http.Response, error) {
+		return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/broadcast_42628_full_v5.json"))
+	})
+	program := "https://audioapi.orf.at/fm4/api/json/5.0/broadcasts/program/4DD"
+	var conditional []string
+	httpmock.RegisterResponder("GET", program, func(req *http.Request) (*http.Response, error) {
+		if etag := req.Header.Get("If-None-Match"); etag != "" {
+			conditional = append(conditional, etag)
+			return httpmock.NewStringResponse(http.StatusNotModified, ""), nil
+		}
+		resp := httpmock.NewStringResponse(200, `{"payload": []}`)
+		resp.Header.Set("ETag", `"v1"`)
+		resp.Header.Set("Cache-Control", "max-age=60")
+		return resp, nil
+	})
+
+	for i := 0; i < 2; i++ {
+		if body, err := fetch(t, completed); err != nil || !strings.Contains(body, `"state"`) {
+			t.Fatalf("got %v, %.40q", err, body)
+		}
+	}
+	if n := httpmock.GetCallCountInfo()["GET "+completed]; n != 1 {
+		t.Errorf("expected the completed broadcast to be fetched once, got %d", n)
+	}
+	clock = clock.Add(25 * time.Hour)
+	_, _ = fetch(t, completed)
+	if n := httpmock.GetCallCountInfo()["GET "+completed]; n != 2 {
+		t.Errorf("expected the completed broadcast to be fetched again after the TTL, got %d", n)
+	}
+
+	_, _ = fetch(t, program)
+	_, _ = fetch(t, program)
+	if len(conditional) != 0 || httpmock.GetCallCountInfo()["GET "+program] != 1 {
+		t.Errorf("expected the program within max-age to come from the cache")
+	}
+	clock = clock.Add(2 * time.Minute)
+	if body, err := fetch(t, program); err != nil || body != `{"payload": []}` {
+		t.Errorf("expected the revalidated body, got %v, %q", err, body)
+	}
+	if len(conditional) != 1 || conditional[0] != `"v1"` {
+		t.Errorf("expected a conditional request with the ETag, got %q", conditional)
+	}
+
+	dir, _, _, _ := responseCache.settings()
+	responseCache.configure(dir, 24*time.Hour, true, false)
+	clock = clock.Add(24 * time.Hour)
+	if _, err := fetch(t, program); err != nil {
+		t.Errorf("expected the stale program from the cache in offline mode, got %v", err)
+	}
+	if _, err := fetch(t, "https://audioapi.orf.at/fm4/api/json/5.0/broadcasts/program/4SS"); err == nil ||
+		!strings.Contains(err.Error(), "not in the cache") {
+		t.Errorf("expected a cache miss to fail in offline mode, got %v", err)
+	}
+	if _, err := fetch(t, "https://loopstreamfm4.apa.at/?channel=fm4&id=x"); err == nil {
+		t.Errorf("expected stream downloads to fail in offline mode")
+	}
+	if len(conditional) != 1 || httpmock.GetTotalCallCount() != 4 {
+		t.Errorf("expected no requests in offline mode, got %d", httpmock.GetTotalCallCount())
+	}
+}
+
+func TestPruneCache(t *testing.T) {
+	dir := t.TempDir()
+	old, recent := filepath.Join(dir, "old.json"), filepath.Join(dir, "recent.json")
+	for _, p := range []string{old, recent} {
+		if err := os.WriteFile(p, []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-100 * 24 * time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := pruneCache(dir, 90*24*time.Hour)
+	if err != nil || removed != 1 {
+		t.Fatalf("got %d, %v want 1 removed", removed, err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("expected the old entry to be removed")
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("expected the recent entry to be kept, got %v", err)
+	}
+	if _, err := pruneCache(filepath.Join(dir, "missing"), time.Hour); err != nil {
+		t.Errorf("expected a missing cache to be fine, got %v", err)
+	}
+}
+
+func TestNotifyWhileOffline(t *testing.T) {
+	server, requests, _ := recordingServer(t)
+	defer responseCache.configure("", 0, false, false)
+	responseCache.configure(t.TempDir(), 24*time.Hour, true, false)
+
+	if err := (webhookSink{url: server.URL}).send(archivedEvent); err != nil || len(*requests) != 1 {
+		t.Errorf("expected the webhook to be sent in offline mode, got %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clip is a stretch of a broadcast, such as a single song or an interview,
+// downloaded on its own instead of the whole episode.
+type clip struct {
+	start, end time.Time
+	title      string
+	// artist is the interpreter of a song; empty for other clips.
+	artist string
+}
+
+// clipOptions are the knobs of the 'clip' subcommand. start and end are
+// positions as parsed by clipPosition.
+type clipOptions struct {
+	start  string
+	end    string
+	title  string
+	outDir string
+}
+
+// clipFileNameReplacer makes a clip title safe to use in a file name.
+var clipFileNameReplacer = strings.NewReplacer(" ", "_", "/", "-", "\\", "-", ":", "-")
+
+// Clip downloads a range of the referenced broadcast (Sendung URL, broadcast
+// id or v5.0 broadcast href) as a clip.
+func Clip(broadcastRef string, opts clipOptions) {
+	href, ok := broadcastHref(broadcastRef)
+	if !ok {
+		fatalf("expected a sound.orf.at Sendung URL, a broadcast id (e.g. 42628) "+
+			"or an audioapi broadcast href, got: %s", broadcastRef)
+	}
+	broadcast := getBroadcast(href)
+	show := createShow(broadcast)
+	if len(show.Streams) == 0 {
+		fatal("No streams found, nothing to clip.", "href", href)
+	}
+
+	c, err := newClip(show, opts)
+	logError(err)
+	_, err = downloadClip(broadcast, c, opts.outDir)
+	logError(err)
+}
+
+// newClip resolves the positions of the options against the show. The end
+// defaults to the end of the item the clip starts with, or to the end of the
+// broadcast; the title to the item's title or the time range.
+func newClip(show Show, opts clipOptions) (clip, error) {
+	start, item, err := clipPosition(show, opts.start, false)
+	if err != nil {
+		return clip{}, fmt.Errorf("-start: %w", err)
+	}
+	var end time.Time
+	switch {
+	case opts.end != "":
+		if end, _, err = clipPosition(show, opts.end, true); err != nil {
+			return clip{}, fmt.Errorf("-end: %w", err)
+		}
+	case item != nil:
+		end = time.UnixMilli(item.End)
+	default:
+		end = time.UnixMilli(show.Streams[0].End)
+	}
+	if !end.After(start) {
+		return clip{}, fmt.Errorf("the clip ends at %s before it starts at %s",
+			end.Local().Format(HHMMSS24h), start.Local().Format(HHMMSS24h))
+	}
+
+	c := clip{start: start, end: end, title: opts.title}
+	if c.title == "" && item != nil && trim(item.Title) != "" {
+		c.title, c.artist = trim(item.Title), trim(item.Interpreter)
+	}
+	if c.title == "" {
+		c.title = fmt.Sprintf("%s %s-%s", show.Title, start.Local().Format("15:04"), end.Local().Format("15:04"))
+	}
+	return c, nil
+}
+
+// clipPosition parses a position in the broadcast: a wall-clock time
+// ("21:15" or "21:15:30"), an offset from the broadcast start ("+1h15m" or
+// "+1:15:00") or the 1-based index of an item as listed by 'inspect' ("#3"),
+// whose start, or end if end is set, is the position.
+func clipPosition(show Show, value string, end bool) (time.Time, *Items, error) {
+	streamStart := time.UnixMilli(show.Streams[0].Start)
+	switch {
+	case value == "":
+		return streamStart, nil, nil
+	case strings.HasPrefix(value, "#"):
+		i, err := strconv.Atoi(value[1:])
+		if err != nil || i < 1 || i > len(show.Items) {
+			return time.Time{}, nil, fmt.Errorf("expected an item between #1 and #%d, got %q", len(show.Items), value)
+		}
+		item := &show.Items[i-1]
+		if end {
+			return time.UnixMilli(item.End), item, nil
+		}
+		return time.UnixMilli(item.Start), item, nil
+	case strings.HasPrefix(value, "+"):
+		offset, err := parseClipOffset(value[1:])
+		if err != nil {
+			return time.Time{}, nil, err
+		}
+		return streamStart.Add(offset), nil, nil
+	default:
+		clock, err := parseClock(value)
+		if err != nil {
+			return time.Time{}, nil, fmt.Errorf("expected HH:MM[:SS], +OFFSET or #ITEM, got %q", value)
+		}
+		// The clock time on the day the broadcast starts, or the next day for
+		// broadcasts running past midnight.
+		local := streamStart.Local()
+		t := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, time.Local).Add(clock)
+		if t.Before(streamStart) {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil, nil
+	}
+}
+
+// parseClipOffset parses an offset as a Go duration ("1h15m") or as h:mm:ss.
+func parseClipOffset(value string) (time.Duration, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return d, nil
+	}
+	if d, err := parseClock(value); err == nil {
+		return d, nil
+	}
+	return 0, fmt.Errorf("expected an offset like +1h15m or +1:15:00, got %q", "+"+value)
+}
+
+// parseClock parses h:mm or h:mm:ss into the time since midnight.
+func parseClock(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, fmt.Errorf("expected h:mm or h:mm:ss, got %q", value)
+	}
+	var d time.Duration
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second}[:len(parts)] {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 || i > 0 && n > 59 {
+			return 0, fmt.Errorf("expected h:mm or h:mm:ss, got %q", value)
+		}
+		d += time.Duration(n) * unit
+	}
+	return d, nil
+}
+
+// downloadClip downloads the clip's range of the broadcast to outDir, with
+// the news and ads inside the range cut like in a full download, and tags it
+// with the show and the clip's title. It returns the path of the clip.
+func downloadClip(broadcast Broadcast, c clip, outDir string) (string, error) {
+	show := createShow(broadcast)
+	if len(show.Streams) == 0 {
+		return "", fmt.Errorf("%s has no stream", show.Title)
+	}
+	segs := clipSegments(show, c.start, c.end)
+	if len(segs) == 0 {
+		return "", fmt.Errorf("nothing of %s from %s to %s is left to download",
+			show.Title, c.start.Local().Format(HHMMSS24h), c.end.Local().Format(HHMMSS24h))
+	}
+	urls := make([]string, len(segs))
+	for i, seg := range segs {
+		urls[i] = getSegmentUrl(show, seg)
+	}
+
+	fileName := fmt.Sprintf("%s_%s_%s_%s.mp3", show.TitleSanitized, show.BroadcastDay,
+		c.start.Local().Format("150405"), clipFileNameReplacer.Replace(trim(c.title)))
+	path := DownloadFileSegments(urls, outDir, fileName)
+
+	artist := c.artist
+	if artist == "" {
+		artist = show.Title
+	}
+	writeClipTag(path, id3Values{
+		Title:       c.title,
+		Album:       fmt.Sprintf("%s - %s", show.Title, show.BroadcastDay),
+		Artist:      artist,
+		AlbumArtist: show.Title,
+		Year:        show.Year,
+	})
+	slog.Info("Downloaded clip", "title", c.title, "broadcast", show.Title, "segments", len(segs), "path", path)
+	return path, nil
+}
+
+// clipSegments returns the stream ranges from start to end that a full
+// download would keep.
+func clipSegments(show Show, start, end time.Time) []segment {
+	streamStart, streamEnd := show.Streams[0].Start, show.Streams[0].End
+	from, to := start.UnixMilli()-streamStart, end.UnixMilli()-streamStart
+	kept := contentSegments(show)
+	if kept == nil {
+		kept = []segment{{0, streamEnd - streamStart}}
+	}
+	var segs []segment
+	for _, seg := range kept {
+		if offset, offsetEnd := max(seg.offset, from), min(seg.offsetEnd, to); offsetEnd > offset {
+			segs = append(segs, segment{offset, offsetEnd})
+		}
+	}
+	return segs
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestNewClip(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	show := createShow(getBroadcast(registerDavidecksDownload()))
+	at := func(clock string) time.Time {
+		t, _ := time.Parse(time.RFC3339Nano, "2026-06-20T"+clock+"Z")
+		return t
+	}
+
+	tests := []struct {
+		name       string
+		opts       clipOptions
+		start, end time.Time
+		title      string
+		err        string
+	}{
+		{"item", clipOptions{start: "#2"}, at("17:03:44.5"), at("17:58:57"), "Davidecks", ""},
+		{"items", clipOptions{start: "#2", end: "#4", title: "Both hours"}, at("17:03:44.5"), at("18:58:49"), "Both hours", ""},
+		{"offsets", clipOptions{start: "+1h", end: "+1:30:00", title: "Guest mix"}, at("17:59:36"), at("18:29:36"), "Guest mix", ""},
+		{"clock", clipOptions{start: at("17:10:00").Local().Format("15:04"), end: at("17:14:30").Local().Format(HHMMSS24h), title: "Interview"},
+			at("17:10:00"), at("17:14:30"), "Interview", ""},
+		{"open end", clipOptions{start: "+1h50m", title: "Finale"}, at("18:49:36"), at("18:59:39"), "Finale", ""},
+		{"unknown item", clipOptions{start: "#99"}, time.Time{}, time.Time{}, "", "-start: expected an item between #1 and #5"},
+		{"garbage", clipOptions{start: "+1h", end: "soon"}, time.Time{}, time.Time{}, "", "-end: expected HH:MM[:SS]"},
+		{"backwards", clipOptions{start: "+1h", end: "+30m"}, time.Time{}, time.Time{}, "", "before it starts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newClip(show, tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !c.start.Equal(tt.start) || !c.end.Equal(tt.end) || c.title != tt.title {
+				t.Errorf("got %s-%s %q want %s-%s %q", c.start.UTC(), c.end.UTC(), c.title, tt.start, tt.end, tt.title)
+			}
+		})
+	}
+}
+
+func TestClip(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628?items=1000",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/broadcast_42628_full_v5.json"))
+		})
+	var requested []string
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://loopstreamfm4\.apa\.at`),
+		func(req *http.Request) (*http.Response, error) {
+			requested = append(requested, req.URL.Query().Get("offset")+"-"+req.URL.Query().Get("offsetende"))
+			return httpmock.NewBytesResponse(200, httpmock.File("../_testdata/show.mp3").Bytes()), nil
+		})
+
+	outDir := t.TempDir()
+	Clip("42628", clipOptions{start: "+55m", end: "+1h5m", title: "Guest mix", outDir: outDir})
+
+	// The weather/ad spot from 59:21 to 1:00:13 is cut from the clip.
+	if want := []string{"3300000-3561000", "3613000-3900000"}; !reflect.DeepEqual(requested, want) {
+		t.Errorf("requested %q want %q", requested, want)
+	}
+	files, _ := filepath.Glob(filepath.Join(outDir, "Davidecks_20260620_*_Guest_mix.mp3"))
+	if len(files) != 1 {
+		t.Fatalf("expected the clip, got %q", files)
+	}
+	tag, err := id3v2.Open(files[0], id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	if tag.Title() != "Guest mix" || tag.Artist() != "Davidecks" || tag.Year() != "2026" {
+		t.Errorf("unexpected tags %q, %q, %q", tag.Title(), tag.Artist(), tag.Year())
+	}
+}
@@ -3,7 +3,7 @@ package main
 import (
 	"github.com/schollz/progressbar/v3"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 )
@@ -26,51 +26,72 @@ func DownloadFileSegments(urls []string, outDir string, filename string) string
 	logError(err)
 
 	if fileIsExisting {
-		log.Println("File " + path + " already exists. Skipping download.")
+		slog.Info("File already exists. Skipping download.", "path", path)
 		return path
 	}
 
-	out, err := os.Create(path)
+	// Download to a temporary name so an aborted download is not mistaken for
+	// an archived file by the existence check of the next run.
+	partPath := path + ".part"
+	logError(downloadSegments(urls, filename, partPath))
+	err = os.Rename(partPath, path)
 	logError(err)
 
-	defer func(out *os.File) {
-		err := out.Close()
+	return path
+}
+
+// downloadSegments downloads the urls, joined, to partPath. On failure the
+// partial file is removed, so an aborted run leaves nothing behind.
+func downloadSegments(urls []string, filename string, partPath string) (err error) {
+	out, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
 		if err != nil {
-			log.Fatal(err)
+			_ = os.Remove(partPath)
 		}
-	}(out)
+	}()
 
 	for _, url := range urls {
-		downloadSegment(url, filename, out)
+		waitForWindow()
+		if err := downloadSegment(url, filename, out); err != nil {
+			return err
+		}
 	}
-
-	return path
+	return nil
 }
 
-func downloadSegment(url string, filename string, out io.Writer) {
-	log.Printf("Downloading file %s from %s.\n", filename, url)
+func downloadSegment(url string, filename string, out io.Writer) error {
+	slog.Info("Downloading file", "file", filename, "url", url)
 
 	req, err := http.NewRequest("GET", url, nil)
-	logError(err)
+	if err != nil {
+		return err
+	}
 	// The loopstream backend expects the sound.orf.at frontend as the origin.
 	// The v5.0 urls.progressive also embeds referer=sound.orf.at as a query
 	// param, but the header is the one the server actually honours.
 	req.Header.Set("Referer", "https://sound.orf.at/")
 	resp, err := http.DefaultClient.Do(req)
-	logError(err)
-
+	if err != nil {
+		return err
+	}
 	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			logError(err)
-		}
+		_ = Body.Close()
 	}(resp.Body)
 
-	bar := progressbar.DefaultBytes(
-		resp.ContentLength,
-		"Downloading",
-	)
+	bar := progressbar.DefaultBytesSilent(resp.ContentLength, "Downloading")
+	if showProgress {
+		bar = progressbar.DefaultBytes(
+			resp.ContentLength,
+			"Downloading",
+		)
+	}
 
-	_, err = io.Copy(io.MultiWriter(out, bar), resp.Body)
-	logError(err)
+	_, err = io.Copy(io.MultiWriter(out, bar), throttledReader{resp.Body})
+	return err
 }
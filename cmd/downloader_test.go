@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"github.com/jarcoal/httpmock"
 	"log"
 	"net/http"
@@ -46,6 +47,31 @@ func TestDownloadFile(t *testing.T) {
 	}
 }
 
+func TestDownloadFileSegmentsAborted(t *testing.T) {
+	outDir := t.TempDir()
+
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://loopstreamfm4.apa.at/?channel=fm4&id=1&offset=0&offsetende=1000",
+		httpmock.NewBytesResponder(200, []byte("first segment")))
+	httpmock.RegisterResponder("GET", "https://loopstreamfm4.apa.at/?channel=fm4&id=1&offset=2000&offsetende=3000",
+		httpmock.NewErrorResponder(errors.New("connection reset")))
+
+	// In -every mode fatal unwinds instead of exiting.
+	ok := runOnce(func() {
+		DownloadFileSegments([]string{
+			"https://loopstreamfm4.apa.at/?channel=fm4&id=1&offset=0&offsetende=1000",
+			"https://loopstreamfm4.apa.at/?channel=fm4&id=1&offset=2000&offsetende=3000",
+		}, outDir, "episode.mp3")
+	})
+	if ok {
+		t.Fatal("expected the run to be aborted")
+	}
+	if files, _ := os.ReadDir(outDir); len(files) != 0 {
+		t.Errorf("expected no leftovers, got %v", files)
+	}
+}
+
 func TestSaveImage(t *testing.T) {
 
 	imageUrl := "https://radiobilder.orf.at/fm4/imgprog/width434/keep/4DD.jpg"
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// plannedEpisode is what downloadBroadcasts would do for one broadcast.
+type plannedEpisode struct {
+	Title        string `json:"title"`
+	BroadcastDay string `json:"broadcastDay"`
+	Path         string `json:"path"`
+	Exists       bool   `json:"exists"`
+	RepeatOf     string `json:"repeatOf,omitempty"`
+	// JingleCut is set when the cuts are only found by matching the jingles
+	// in the downloaded stream.
+	JingleCut    bool               `json:"jingleCut,omitempty"`
+	Segments     []inspectedSegment `json:"segments,omitempty"`
+	KeptDuration int64              `json:"keptDuration"`
+	Size         int64              `json:"size"` // bytes, -1 if unknown
+	CoverUrl     string             `json:"coverUrl,omitempty"`
+	Tags         id3Values          `json:"tags"`
+}
+
+// planEpisode computes the download plan of a broadcast with the segments and
+// the repeat detection of a real run. Besides the API requests, only HEAD
+// requests are issued for the expected size, skipped for archived files, and
+// short windows of the stream are read for -refine-cuts and -repeat-audio.
+// Nothing is written to disk; the run's cache is read-only. Episodes cut by
+// the jingles are planned as the whole stream they are downloaded as.
+// repeats is nil without a repeat policy.
+func planEpisode(broadcast Broadcast, destDir string, opts downloadOptions, repeats *repeatIndex) plannedEpisode {
+	show := createShow(broadcast)
+	path := getFilePath(destDir, show)
+	exists, err := fileExists(path)
+	logError(err)
+
+	plan := plannedEpisode{
+		Title:        show.Title,
+		BroadcastDay: show.BroadcastDay,
+		Path:         path,
+		Exists:       exists,
+		Size:         -1,
+		CoverUrl:     getCoverUrl(show),
+		Tags:         getId3Values(show),
+	}
+	if len(show.Streams) == 0 {
+		return plan
+	}
+
+	if repeats != nil {
+		ep := &processedEpisode{broadcast: broadcast, show: show, destDir: destDir, path: path, existing: exists}
+		if original, found := findOriginal(ep, repeats, opts); found {
+			plan.RepeatOf = original.path
+		}
+	}
+
+	segs := contentSegments(show)
+	switch {
+	case exists || plan.skipped(opts):
+	case jingleCut(show, opts):
+		segs = nil
+		plan.JingleCut = true
+	default:
+		segs = refineSegments(show, segs, opts.refineCuts)
+	}
+	plan.Segments, plan.KeptDuration = inspectSegments(show, segs)
+	if !exists && !plan.skipped(opts) {
+		plan.Size = 0
+		for _, seg := range plan.Segments {
+			size := contentLength(seg.URL)
+			if size < 0 {
+				plan.Size = -1
+				break
+			}
+			plan.Size += size
+		}
+		if repeats != nil {
+			// Later broadcasts of the run may repeat this one.
+			repeats.add(path, broadcast.BroadcastDay, contentItems(broadcast.Items))
+		}
+	}
+	return plan
+}
+
+// skipped reports whether the repeat policy keeps the episode from being
+// downloaded.
+func (p plannedEpisode) skipped(opts downloadOptions) bool {
+	return p.RepeatOf != "" && (opts.repeats == repeatSkip || opts.repeats == repeatLink)
+}
+
+// contentLength asks the server for the size of url without downloading it.
+// Returns -1 if the server does not tell.
+func contentLength(url string) int64 {
+	req, err := http.NewRequest("HEAD", url, nil)
+	if err != nil {
+		return -1
+	}
+	req.Header.Set("Referer", "https://sound.orf.at/")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return -1
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
+}
+
+// printDryRun prints the download plan of all broadcasts and the total
+// number of bytes that a real run would fetch.
+func printDryRun(w io.Writer, broadcasts []Broadcast, destDir string, opts downloadOptions, repeats *repeatIndex) {
+	var total int64
+	sizeKnown := true
+	for _, broadcast := range broadcasts {
+		plan := planEpisode(broadcast, destDir, opts, repeats)
+
+		_, _ = fmt.Fprintf(w, "\n%s - %s\n", plan.Title, plan.BroadcastDay)
+		_, _ = fmt.Fprintf(w, "  path:     %s\n", plan.Path)
+		switch {
+		case len(plan.Segments) == 0:
+			_, _ = fmt.Fprintln(w, "  action:   skip (no streams)")
+			continue
+		case plan.Exists:
+			_, _ = fmt.Fprintln(w, "  action:   skip (already archived)")
+			continue
+		case plan.skipped(opts) && opts.repeats == repeatLink:
+			_, _ = fmt.Fprintf(w, "  action:   hardlink (repeats %s)\n", plan.RepeatOf)
+			continue
+		case plan.skipped(opts):
+			_, _ = fmt.Fprintf(w, "  action:   skip (repeats %s)\n", plan.RepeatOf)
+			continue
+		case plan.JingleCut:
+			_, _ = fmt.Fprintf(w, "  action:   download the whole stream, %s of audio, %s, and cut by the reference clips\n",
+				formatMs(plan.KeptDuration), formatSize(plan.Size))
+		default:
+			_, _ = fmt.Fprintf(w, "  action:   download %d segment(s), %s of audio, %s\n",
+				len(plan.Segments), formatMs(plan.KeptDuration), formatSize(plan.Size))
+		}
+		for _, seg := range plan.Segments {
+			_, _ = fmt.Fprintf(w, "            %s\n", seg.URL)
+		}
+		if plan.RepeatOf != "" {
+			_, _ = fmt.Fprintf(w, "  repeats:  %s\n", plan.RepeatOf)
+		}
+		if plan.CoverUrl != "" {
+			_, _ = fmt.Fprintf(w, "  cover:    %s\n", plan.CoverUrl)
+		}
+		tags, _ := json.Marshal(plan.Tags)
+		_, _ = fmt.Fprintf(w, "  tags:     %s\n", tags)
+
+		if plan.Size < 0 {
+			sizeKnown = false
+		} else {
+			total += plan.Size
+		}
+	}
+
+	if sizeKnown {
+		_, _ = fmt.Fprintf(w, "\nDry run: would download %s.\n", formatSize(total))
+	} else {
+		_, _ = fmt.Fprintf(w, "\nDry run: would download at least %s (some sizes unknown).\n", formatSize(total))
+	}
+}
+
+func formatSize(bytes int64) string {
+	if bytes < 0 {
+		return "unknown size"
+	}
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestDryRunWritesNothing(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	broadcastUrl := "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628"
+	httpmock.RegisterResponder("GET", broadcastUrl+"?items=1000",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/broadcast_42628_full_v5.json"))
+		},
+	)
+	// Every segment answers the HEAD with its size; GETs are not registered,
+	// so an accidental download fails the test.
+	httpmock.RegisterRegexpResponder("HEAD", regexp.MustCompile(`^https://loopstreamfm4\.apa\.at`),
+		func(req *http.Request) (*http.Response, error) {
+			resp := httpmock.NewStringResponse(200, "")
+			resp.ContentLength = 1000
+			return resp, nil
+		},
+	)
+
+	destDir, cacheDir := t.TempDir(), t.TempDir()
+	defer responseCache.configure("", 0, false, false)
+	responseCache.configure(cacheDir, 24*time.Hour, false, true)
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{dryRun: true})
+	responseCache.configure("", 0, false, false)
+
+	for _, dir := range []string{destDir, cacheDir} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 0 {
+			t.Errorf("dry run created %d entries in %s", len(entries), dir)
+		}
+	}
+
+	plan := planEpisode(getBroadcast(broadcastUrl), destDir, downloadOptions{}, nil)
+	if plan.Exists || len(plan.Segments) != 2 || plan.Size != 2000 {
+		t.Errorf("plan got %+v", plan)
+	}
+	if plan.Tags.Title != "Davidecks - 20260620" {
+		t.Errorf("tag title got %q", plan.Tags.Title)
+	}
+
+	var out bytes.Buffer
+	printDryRun(&out, []Broadcast{getBroadcast(broadcastUrl)}, destDir, downloadOptions{}, nil)
+	if !strings.Contains(out.String(), "would download 2.0 KiB") {
+		t.Errorf("output got %s", out.String())
+	}
+}
+
+func TestDryRunRepeats(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	urls := []string{registerDavidecksDownload(), registerRepeat()}
+	httpmock.RegisterRegexpResponder("HEAD", regexp.MustCompile(`^https://loopstreamfm4\.apa\.at`),
+		httpmock.NewStringResponder(200, ""))
+
+	var broadcasts []Broadcast
+	for _, url := range urls {
+		broadcasts = append(broadcasts, getBroadcast(url))
+	}
+	destDir := t.TempDir()
+	originalPath := getFilePath(destDir, createShow(broadcasts[0]))
+
+	// The original is only planned, yet the repeat already refers to it.
+	var out bytes.Buffer
+	printDryRun(&out, broadcasts, destDir, downloadOptions{repeats: repeatSkip}, newRepeatIndex())
+	if !strings.Contains(out.String(), "action:   skip (repeats "+originalPath+")") {
+		t.Errorf("expected the repeat to be skipped, got %s", out.String())
+	}
+
+	downloadBroadcasts(urls[:1], destDir, downloadOptions{})
+	out.Reset()
+	printDryRun(&out, broadcasts[1:], destDir, downloadOptions{repeats: repeatLink}, newRepeatIndex())
+	if !strings.Contains(out.String(), "action:   hardlink (repeats "+originalPath+")") {
+		t.Errorf("expected the repeat to be hardlinked, got %s", out.String())
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{-1: "unknown size", 512: "512 B", 2048: "2.0 KiB", 173015040: "165.0 MiB"}
+	for in, want := range cases {
+		if got := formatSize(in); got != want {
+			t.Errorf("formatSize(%d) got %q want %q", in, got, want)
+		}
+	}
+}
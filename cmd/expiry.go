@@ -0,0 +1,65 @@
+package main
+
+import (
+	"log/slog"
+	"sort"
+	"time"
+)
+
+// now is the clock used for expiry decisions; tests pin it.
+var now = time.Now
+
+// sortByExpiry orders the broadcasts so the ones leaving the on-demand window
+// first come first. Broadcasts without an expiry keep their relative order
+// after all others.
+func sortByExpiry(broadcasts []Broadcast) {
+	sort.SliceStable(broadcasts, func(i, j int) bool {
+		a, b := broadcasts[i].Expiry, broadcasts[j].Expiry
+		if a.IsZero() || b.IsZero() {
+			return !a.IsZero() && b.IsZero()
+		}
+		return a.Before(b)
+	})
+}
+
+// warnExpiring logs a warning for every broadcast that expires within
+// opts.expiryWarn and is not archived below destDir yet, and sends an expiring
+// event for it (except in a dry run). Returns the events.
+func warnExpiring(broadcasts []Broadcast, destDir string, opts downloadOptions) []event {
+	if opts.expiryWarn <= 0 {
+		return nil
+	}
+
+	var events []event
+	for _, broadcast := range broadcasts {
+		if broadcast.Expiry.IsZero() || broadcast.Expiry.Sub(now()) > opts.expiryWarn {
+			continue
+		}
+		path := getFilePath(destDir, createShow(broadcast))
+		archived, err := fileExists(path)
+		logError(err)
+		if archived {
+			continue
+		}
+
+		slog.Warn("Episode expires soon and is not archived yet!",
+			"title", trim(broadcast.Title),
+			"broadcastDay", broadcast.BroadcastDay,
+			"expiresIn", broadcast.Expiry.Sub(now()).Round(time.Minute).String(),
+			"expiry", broadcast.Expiry)
+
+		e := event{
+			Event:        eventExpiring,
+			Title:        trim(broadcast.Title),
+			ProgramKey:   broadcast.ProgramKey,
+			BroadcastDay: broadcast.BroadcastDay,
+			Expiry:       broadcast.Expiry,
+			Path:         path,
+		}
+		if !opts.dryRun {
+			opts.notify.notify(e)
+		}
+		events = append(events, e)
+	}
+	return events
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestSortByExpiry(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 7, d, 0, 0, 0, 0, time.UTC) }
+	broadcasts := []Broadcast{
+		{ID: 1, Expiry: day(20)},
+		{ID: 2},
+		{ID: 3, Expiry: day(13)},
+		{ID: 4},
+		{ID: 5, Expiry: day(15)},
+	}
+
+	sortByExpiry(broadcasts)
+
+	var got []int
+	for _, b := range broadcasts {
+		got = append(got, b.ID)
+	}
+	want := []int{3, 5, 1, 2, 4}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+}
+
+func TestWarnExpiring(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var posted []event
+	webhook := "https://hooks.example.org/expiry"
+	httpmock.RegisterResponder("POST", webhook,
+		func(req *http.Request) (*http.Response, error) {
+			var e event
+			if err := json.NewDecoder(req.Body).Decode(&e); err != nil {
+				return httpmock.NewStringResponse(400, ""), nil
+			}
+			posted = append(posted, e)
+			return httpmock.NewStringResponse(204, ""), nil
+		},
+	)
+
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Date(2026, 7, 19, 12, 0, 0, 0, time.UTC) }
+
+	episode := func(day int, expiry time.Time) Broadcast {
+		return Broadcast{
+			Title:        "Davidecks",
+			ProgramKey:   "4DD",
+			BroadcastDay: day,
+			StartISO:     time.Date(2026, 6, 20, 17, 0, 0, 0, time.UTC),
+			Expiry:       expiry,
+		}
+	}
+	broadcasts := []Broadcast{
+		episode(20260620, time.Date(2026, 7, 20, 16, 59, 36, 0, time.UTC)), // in ~29h, archived
+		episode(20260621, time.Date(2026, 7, 21, 0, 0, 0, 0, time.UTC)),    // in 36h, not archived
+		episode(20260627, time.Date(2026, 7, 27, 0, 0, 0, 0, time.UTC)),    // in a week
+		episode(20260628, time.Time{}),                                     // unknown expiry
+	}
+
+	destDir := t.TempDir()
+	archived := path.Join(destDir, "Davidecks", "2026", "Davidecks_20260620.mp3")
+	if err := os.MkdirAll(path.Dir(archived), 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFile("../_testdata/show.mp3", archived)
+
+	got := warnExpiring(broadcasts, destDir, downloadOptions{expiryWarn: 48 * time.Hour, notify: notifier{webhookSink{url: webhook}}})
+
+	if len(got) != 1 || got[0].BroadcastDay != 20260621 {
+		t.Fatalf("got %+v, want a single event for 20260621", got)
+	}
+	if !reflect.DeepEqual(posted, got) {
+		t.Errorf("webhook got %+v want %+v", posted, got)
+	}
+
+	if got := warnExpiring(broadcasts, destDir, downloadOptions{}); got != nil {
+		t.Errorf("got %+v, want no events when warnings are disabled", got)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// broadcastDayLayout is the layout of the API's broadcastDay (e.g. 20220806).
+const broadcastDayLayout = "20060102"
+
+// broadcastSummary is the flat, listing-level view of a broadcast shared by the
+// search hits, the episode list of a program and a station's schedule. It
+// carries just enough to filter, sort and print broadcasts before committing to
+// the (per-episode) broadcast/{id} fetch.
+type broadcastSummary struct {
+	ID         int    `json:"id"`
+	Href       string `json:"href"`
+	Station    string `json:"station"`
+	ProgramKey string `json:"programKey"`
+	Title      string `json:"title"`
+	Subtitle   string `json:"subtitle,omitempty"`
+	// PressRelease is only matched by subscription rules; it is too long for
+	// the listings.
+	PressRelease   string    `json:"-"`
+	BroadcastDay   int       `json:"broadcastDay"`
+	Start          time.Time `json:"start"`
+	End            time.Time `json:"end"`
+	Duration       int64     `json:"duration"` // milliseconds, like the v5.0 API
+	State          string    `json:"state,omitempty"`
+	IsOnDemand     bool      `json:"isOnDemand"`
+	IsGeoProtected bool      `json:"isGeoProtected"`
+	Expiry         time.Time `json:"expiry,omitzero"`
+}
+
+func (b Broadcast) toSummary() broadcastSummary {
+	return broadcastSummary{
+		ID:             b.ID,
+		Href:           b.Href,
+		Station:        b.Station,
+		ProgramKey:     b.ProgramKey,
+		Title:          trim(b.Title),
+		Subtitle:       removeHtmlTags(trim(b.Subtitle)),
+		PressRelease:   removeHtmlTags(trim(b.PressRelease)),
+		BroadcastDay:   b.BroadcastDay,
+		Start:          b.StartISO,
+		End:            b.EndISO,
+		Duration:       b.End - b.Start,
+		State:          b.State,
+		IsOnDemand:     b.IsOnDemand,
+		IsGeoProtected: b.IsGeoProtected,
+		Expiry:         b.Expiry,
+	}
+}
+
+func (b broadcastSummary) duration() time.Duration {
+	return time.Duration(b.Duration) * time.Millisecond
+}
+
+// weekday is the weekday of the start, or of the broadcast day for the
+// episode list entries that come without a start.
+func (b broadcastSummary) weekday() time.Weekday {
+	if b.Start.IsZero() {
+		day, _ := time.Parse(broadcastDayLayout, strconv.Itoa(b.BroadcastDay))
+		return day.Weekday()
+	}
+	return b.Start.Weekday()
+}
+
+// broadcastFilter narrows a list of broadcastSummary. The zero value matches
+// everything; each set field adds a constraint.
+type broadcastFilter struct {
+	Station      string
+	ProgramKey   string
+	Title        string // substring, case-insensitive
+	Since        int    // broadcastDay, inclusive; 0 = open
+	Until        int    // broadcastDay, inclusive; 0 = open
+	Weekdays     []time.Weekday
+	MinDuration  time.Duration
+	OnDemandOnly bool
+}
+
+func (f broadcastFilter) match(b broadcastSummary) bool {
+	if f.Station != "" && !strings.EqualFold(f.Station, b.Station) {
+		return false
+	}
+	if f.ProgramKey != "" && !strings.EqualFold(f.ProgramKey, b.ProgramKey) {
+		return false
+	}
+	if f.Title != "" && !strings.Contains(strings.ToLower(b.Title), strings.ToLower(f.Title)) {
+		return false
+	}
+	if f.Since != 0 && b.BroadcastDay < f.Since {
+		return false
+	}
+	if f.Until != 0 && b.BroadcastDay > f.Until {
+		return false
+	}
+	if len(f.Weekdays) > 0 && !containsWeekday(f.Weekdays, b.weekday()) {
+		return false
+	}
+	if f.MinDuration > 0 && b.duration() < f.MinDuration {
+		return false
+	}
+	if f.OnDemandOnly && !b.IsOnDemand {
+		return false
+	}
+	return true
+}
+
+func (f broadcastFilter) apply(broadcasts []broadcastSummary) []broadcastSummary {
+	var result []broadcastSummary
+	for _, b := range broadcasts {
+		if f.match(b) {
+			result = append(result, b)
+		}
+	}
+	return result
+}
+
+func containsWeekday(weekdays []time.Weekday, day time.Weekday) bool {
+	for _, w := range weekdays {
+		if w == day {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWeekdays parses a comma separated list of english weekday names, either
+// abbreviated or in full (e.g. "sat,sun" or "Monday"). An empty string yields
+// no constraint.
+func parseWeekdays(value string) ([]time.Weekday, error) {
+	var weekdays []time.Weekday
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(trim(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for d := time.Sunday; d <= time.Saturday; d++ {
+			full := strings.ToLower(d.String())
+			if name == full || name == full[:3] {
+				weekdays = append(weekdays, d)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown weekday %q", name)
+		}
+	}
+	return weekdays, nil
+}
+
+// parseBroadcastDay parses a YYYYMMDD date into the API's int broadcastDay.
+// An empty string yields 0 (no constraint).
+func parseBroadcastDay(value string) (int, error) {
+	value = trim(value)
+	if value == "" {
+		return 0, nil
+	}
+	if _, err := time.Parse(broadcastDayLayout, value); err != nil {
+		return 0, fmt.Errorf("expected a date as YYYYMMDD, got %q", value)
+	}
+	return strconv.Atoi(value)
+}
+
+// filterFlags registers the broadcastFilter command line flags on a subcommand.
+type filterFlags struct {
+	station     *string
+	programKey  *string
+	since       *string
+	until       *string
+	weekday     *string
+	minDuration *time.Duration
+	onDemand    *bool
+}
+
+func addFilterFlags(fs *flag.FlagSet) *filterFlags {
+	return &filterFlags{
+		station:     fs.String("station", "", "Only broadcasts of this station (e.g. fm4)"),
+		programKey:  fs.String("program-key", "", "Only broadcasts of this programKey (e.g. 4DD)"),
+		since:       fs.String("since", "", "Only broadcasts on or after this day (YYYYMMDD)"),
+		until:       fs.String("until", "", "Only broadcasts on or before this day (YYYYMMDD)"),
+		weekday:     fs.String("weekday", "", "Only broadcasts on these weekdays (e.g. sat,sun)"),
+		minDuration: fs.Duration("min-duration", 0, "Only broadcasts lasting at least this long (e.g. 90m)"),
+		onDemand:    fs.Bool("on-demand", false, "Only broadcasts available on demand"),
+	}
+}
+
+// filter builds the broadcastFilter from the parsed flags, exiting on invalid
+// values like the rest of the command line handling.
+func (f *filterFlags) filter() broadcastFilter {
+	since, err := parseBroadcastDay(*f.since)
+	logError(err)
+	until, err := parseBroadcastDay(*f.until)
+	logError(err)
+	weekdays, err := parseWeekdays(*f.weekday)
+	logError(err)
+	return broadcastFilter{
+		Station:      *f.station,
+		ProgramKey:   *f.programKey,
+		Since:        since,
+		Until:        until,
+		Weekdays:     weekdays,
+		MinDuration:  *f.minDuration,
+		OnDemandOnly: *f.onDemand,
+	}
+}
+
+// episodeSelection picks the episodes of a program that 'url' and 'download'
+// fetch. The zero value selects the whole on-demand window.
+type episodeSelection struct {
+	// onlyThisEpisode downloads just the episode a Sendung URL points at.
+	onlyThisEpisode bool
+	filter          broadcastFilter
+	// latest, if set, keeps only this many of the newest matching episodes.
+	latest int
+}
+
+func (s episodeSelection) apply(episodes []broadcastSummary) []broadcastSummary {
+	episodes = s.filter.apply(episodes)
+	if s.latest > 0 && len(episodes) > s.latest {
+		sort.SliceStable(episodes, func(i, j int) bool {
+			return episodes[i].BroadcastDay > episodes[j].BroadcastDay
+		})
+		episodes = episodes[:s.latest]
+	}
+	return episodes
+}
+
+// selectionFlags registers the episodeSelection command line flags.
+type selectionFlags struct {
+	onlyThisEpisode *bool
+	date            *string
+	since           *string
+	until           *string
+	weekday         *string
+	latest          *int
+}
+
+func addSelectionFlags(fs *flag.FlagSet) *selectionFlags {
+	return &selectionFlags{
+		onlyThisEpisode: fs.Bool("only-this-episode", false, "Download just the episode of the Sendung URL, not its whole show"),
+		date:            fs.String("date", "", "Only the episode of this day (YYYYMMDD)"),
+		since:           fs.String("since", "", "Only episodes on or after this day (YYYYMMDD)"),
+		until:           fs.String("until", "", "Only episodes on or before this day (YYYYMMDD)"),
+		weekday:         fs.String("weekday", "", "Only episodes on these weekdays (e.g. sat,sun)"),
+		latest:          fs.Int("latest", 0, "Only the newest N of the matching episodes"),
+	}
+}
+
+func (f *selectionFlags) selection() episodeSelection {
+	since, err := parseBroadcastDay(*f.since)
+	logError(err)
+	until, err := parseBroadcastDay(*f.until)
+	logError(err)
+	date, err := parseBroadcastDay(*f.date)
+	logError(err)
+	if date != 0 {
+		if since != 0 || until != 0 {
+			fatal("-date can't be combined with -since or -until")
+		}
+		since, until = date, date
+	}
+	weekdays, err := parseWeekdays(*f.weekday)
+	logError(err)
+	if *f.latest < 0 {
+		fatal("-latest must not be negative", "latest", *f.latest)
+	}
+	if *f.onlyThisEpisode && (since != 0 || until != 0 || len(weekdays) > 0 || *f.latest > 0) {
+		fatal("-only-this-episode can't be combined with -date, -since, -until, -weekday or -latest")
+	}
+	return episodeSelection{
+		onlyThisEpisode: *f.onlyThisEpisode,
+		filter:          broadcastFilter{Since: since, Until: until, Weekdays: weekdays},
+		latest:          *f.latest,
+	}
+}
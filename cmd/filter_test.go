@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseWeekdays(t *testing.T) {
+	got, err := parseWeekdays("sat, Sunday,MON")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []time.Weekday{time.Saturday, time.Sunday, time.Monday}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	if _, err := parseWeekdays("caturday"); err == nil {
+		t.Error("expected an error for an unknown weekday")
+	}
+}
+
+func TestParseBroadcastDay(t *testing.T) {
+	if got, err := parseBroadcastDay("20220806"); err != nil || got != 20220806 {
+		t.Errorf("got %d, %v want 20220806", got, err)
+	}
+	if got, err := parseBroadcastDay(""); err != nil || got != 0 {
+		t.Errorf("got %d, %v want 0 for empty input", got, err)
+	}
+	if _, err := parseBroadcastDay("2022-08-06"); err == nil {
+		t.Error("expected an error for a non-YYYYMMDD date")
+	}
+}
+
+func TestSelectionFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{[]string{"-since", "20260601", "-weekday", "sat", "-latest", "2"}, true},
+		{[]string{"-only-this-episode"}, true},
+		{[]string{"-date", "20260620", "-since", "20260601"}, false},
+		{[]string{"-latest", "-1"}, false},
+		{[]string{"-only-this-episode", "-date", "20260620"}, false},
+		{[]string{"-only-this-episode", "-until", "20260620"}, false},
+		{[]string{"-only-this-episode", "-weekday", "sat"}, false},
+		{[]string{"-only-this-episode", "-latest", "1"}, false},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("url", flag.ContinueOnError)
+		f := addSelectionFlags(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if ok := runOnce(func() { f.selection() }); ok != tt.ok {
+			t.Errorf("%v: got ok %v want %v", tt.args, ok, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// broadcastIdPattern matches a bare v5.0 broadcast id (e.g. "42628").
+var broadcastIdPattern = regexp.MustCompile(`^\d+$`)
+
+// inspection is the cut plan of a single broadcast as printed by 'inspect'.
+// Offsets are milliseconds from the broadcast start, i.e. the loopstream
+// &offset/&offsetende coordinate.
+type inspection struct {
+	Title        string             `json:"title"`
+	BroadcastDay string             `json:"broadcastDay"`
+	Start        time.Time          `json:"start"`
+	End          time.Time          `json:"end"`
+	Duration     int64              `json:"duration"`
+	Items        []inspectedItem    `json:"items"`
+	Segments     []inspectedSegment `json:"segments"`
+	KeptDuration int64              `json:"keptDuration"`
+}
+
+type inspectedItem struct {
+	Type      string    `json:"type"`
+	Title     string    `json:"title,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Offset    int64     `json:"offset"`
+	OffsetEnd int64     `json:"offsetEnd"`
+	Duration  int64     `json:"duration"`
+	Cut       bool      `json:"cut"`
+	Reason    string    `json:"reason,omitempty"`
+}
+
+type inspectedSegment struct {
+	Offset    int64  `json:"offset"`
+	OffsetEnd int64  `json:"offsetEnd"`
+	Duration  int64  `json:"duration"`
+	URL       string `json:"url"`
+}
+
+// Inspect prints the item metadata cut plan of the referenced broadcast
+// (Sendung URL, broadcast id or v5.0 broadcast href) without downloading
+// anything.
+func Inspect(broadcastRef string, format string) {
+	href, ok := broadcastHref(broadcastRef)
+	if !ok {
+		fatalf("expected a sound.orf.at Sendung URL, a broadcast id (e.g. 42628) "+
+			"or an audioapi broadcast href, got: %s", broadcastRef)
+	}
+
+	show := createShow(getBroadcast(href))
+	if len(show.Streams) == 0 {
+		fatal("No streams found, nothing to inspect.", "href", href)
+	}
+
+	err := printInspection(os.Stdout, inspect(show), format)
+	logError(err)
+}
+
+// broadcastHref resolves a reference to a single broadcast into its v5.0
+// broadcast/{id} href.
+func broadcastHref(broadcastRef string) (string, bool) {
+	if matches := soundUrlPattern.FindStringSubmatch(broadcastRef); matches != nil {
+		return "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/" + matches[1], true
+	}
+	if broadcastIdPattern.MatchString(broadcastRef) {
+		return "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/" + broadcastRef, true
+	}
+	if strings.HasPrefix(broadcastRef, "https://audioapi.orf.at/") {
+		return broadcastRef, true
+	}
+	return "", false
+}
+
+// inspect computes the cut plan of the show's item metadata, the one
+// downloadBroadcasts uses without -refine-cuts and -jingles. Those move or
+// add cuts from the audio, which inspect does not read.
+func inspect(show Show) inspection {
+	stream := show.Streams[0]
+	result := inspection{
+		Title:        show.Title,
+		BroadcastDay: show.BroadcastDay,
+		Start:        time.UnixMilli(stream.Start),
+		End:          time.UnixMilli(stream.End),
+		Duration:     stream.End - stream.Start,
+	}
+
+	for _, item := range show.Items {
+		reason := cutReason(item.Type)
+		result.Items = append(result.Items, inspectedItem{
+			Type:      item.Type,
+			Title:     trim(item.Title),
+			Start:     time.UnixMilli(item.Start),
+			End:       time.UnixMilli(item.End),
+			Offset:    item.Start - stream.Start,
+			OffsetEnd: item.End - stream.Start,
+			Duration:  item.End - item.Start,
+			Cut:       reason != "",
+			Reason:    reason,
+		})
+	}
+
+	result.Segments, result.KeptDuration = inspectSegments(show, contentSegments(show))
+	return result
+}
+
+// inspectSegments describes the segments downloadBroadcasts fetches for segs
+// and returns them with the kept duration.
+func inspectSegments(show Show, segs []segment) ([]inspectedSegment, int64) {
+	if len(segs) == 0 {
+		// Nothing to cut: downloadBroadcasts fetches the whole stream.
+		duration := show.Streams[0].End - show.Streams[0].Start
+		return []inspectedSegment{{
+			Offset:    0,
+			OffsetEnd: duration,
+			Duration:  duration,
+			URL:       getDownloadUrl(show),
+		}}, duration
+	}
+	var inspected []inspectedSegment
+	var kept int64
+	for _, seg := range segs {
+		inspected = append(inspected, inspectedSegment{
+			Offset:    seg.offset,
+			OffsetEnd: seg.offsetEnd,
+			Duration:  seg.offsetEnd - seg.offset,
+			URL:       getSegmentUrl(show, seg),
+		})
+		kept += seg.offsetEnd - seg.offset
+	}
+	return inspected, kept
+}
+
+func printInspection(w io.Writer, plan inspection, format string) error {
+	switch format {
+	case "", "text":
+		_, _ = fmt.Fprintf(w, "%s - %s\n", plan.Title, plan.BroadcastDay)
+		_, _ = fmt.Fprintf(w, "%s - %s (%s)\n\n",
+			plan.Start.Local().Format(YYYYMMDD+" "+HHMMSS24h), plan.End.Local().Format(HHMMSS24h), formatMs(plan.Duration))
+
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "#\tTYPE\tSTART\tEND\tDURATION\tOFFSET\tACTION\tTITLE")
+		for i, item := range plan.Items {
+			action := "keep"
+			if item.Cut {
+				action = "cut: " + item.Reason
+			}
+			_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d-%d\t%s\t%s\n",
+				i+1, item.Type, item.Start.Local().Format(HHMMSS24h), item.End.Local().Format(HHMMSS24h),
+				formatMs(item.Duration), item.Offset, item.OffsetEnd, action, item.Title)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+
+		_, _ = fmt.Fprintf(w, "\n%s\n\n", timeline(plan, 72))
+
+		_, _ = fmt.Fprintf(w, "Kept segments (%s of %s):\n", formatMs(plan.KeptDuration), formatMs(plan.Duration))
+		for i, seg := range plan.Segments {
+			_, _ = fmt.Fprintf(w, "  %d) %d-%d (%s)\n     %s\n", i+1, seg.Offset, seg.OffsetEnd, formatMs(seg.Duration), seg.URL)
+		}
+		return nil
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(plan)
+	default:
+		return fmt.Errorf("unknown format %q, expected text or json", format)
+	}
+}
+
+// timeline renders the broadcast as a bar of the given width: '=' for kept
+// audio and 'x' for audio that is cut.
+func timeline(plan inspection, width int) string {
+	if plan.Duration <= 0 {
+		return ""
+	}
+	bar := []byte(strings.Repeat("x", width))
+	for _, seg := range plan.Segments {
+		from := int(seg.Offset * int64(width) / plan.Duration)
+		to := int((seg.OffsetEnd*int64(width) + plan.Duration - 1) / plan.Duration)
+		for i := from; i < to && i < width; i++ {
+			bar[i] = '='
+		}
+	}
+	return "|" + string(bar) + "|"
+}
+
+// formatMs formats a millisecond duration as h:mm:ss.
+func formatMs(ms int64) string {
+	d := time.Duration(ms) * time.Millisecond
+	return fmt.Sprintf("%d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
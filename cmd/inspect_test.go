@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestInspect(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628?items=1000",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/broadcast_42628_full_v5.json"))
+		},
+	)
+
+	href, ok := broadcastHref(soundUrlDavidecks)
+	if !ok {
+		t.Fatalf("could not resolve %s", soundUrlDavidecks)
+	}
+	plan := inspect(createShow(getBroadcast(href)))
+
+	// Items: 0=News (N), 1=content (B), 2=ad (W), 3=content (B), 4=ad (W).
+	var cut []int
+	for i, item := range plan.Items {
+		if item.Cut {
+			cut = append(cut, i)
+		}
+	}
+	if len(cut) != 3 || cut[0] != 0 || cut[1] != 2 || cut[2] != 4 {
+		t.Errorf("cut items got %v want [0 2 4]", cut)
+	}
+	if plan.Items[0].Reason != "type N (news)" {
+		t.Errorf("reason got %q", plan.Items[0].Reason)
+	}
+
+	if len(plan.Segments) != 2 {
+		t.Fatalf("got %d segments, want 2", len(plan.Segments))
+	}
+	wantURL := "https://loopstreamfm4.apa.at?channel=fm4&id=2026-06-20_1859_tl_54_7DaysSat5_180163.mp3&offset=248500&offsetende=3561000"
+	if plan.Segments[0].URL != wantURL {
+		t.Errorf("segment URL got %q want %q", plan.Segments[0].URL, wantURL)
+	}
+	if want := int64(3561000 - 248500 + 7153000 - 3613000); plan.KeptDuration != want {
+		t.Errorf("kept duration got %d want %d", plan.KeptDuration, want)
+	}
+
+	var out bytes.Buffer
+	if err := printInspection(&out, plan, "text"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "cut: type W (weather/ad spot)") || !strings.Contains(out.String(), "|x") {
+		t.Errorf("text output got %s", out.String())
+	}
+}
+
+func TestBroadcastHref(t *testing.T) {
+	want := "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628"
+	for _, ref := range []string{soundUrlDavidecks, "42628", want} {
+		if got, ok := broadcastHref(ref); !ok || got != want {
+			t.Errorf("%s: got %q, %v want %q", ref, got, ok, want)
+		}
+	}
+	if _, ok := broadcastHref("4DD"); ok {
+		t.Error("a programKey is not a broadcast reference")
+	}
+}
+
+func TestTimeline(t *testing.T) {
+	plan := inspection{Duration: 100, Segments: []inspectedSegment{{Offset: 10, OffsetEnd: 50}, {Offset: 60, OffsetEnd: 100}}}
+
+	got := timeline(plan, 10)
+	want := "|x====x====|"
+	if got != want {
+		t.Errorf("got %q want %q", got, want)
+	}
+}
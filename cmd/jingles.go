@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Audio fingerprints follow Haitsma and Kalker: the mono signal is decimated
+// to about 5.5 kHz, and every hop the energies of 33 log spaced bands between
+// 300 Hz and 2.7 kHz are compared with their neighbours and the previous
+// frame, giving one 32 bit word per hop.
+const (
+	fingerprintRate   = 5500
+	fingerprintWindow = 2048
+	fingerprintHop    = 64
+	fingerprintBands  = 33
+	// matchThreshold is the highest bit error rate still counted as a match.
+	// Exact copies score below 0.1, while looped beats in a DJ mix can reach
+	// 0.2 against a different spot of the same track.
+	matchThreshold = 0.15
+	// maxCutSpan limits how far after a start clip its end clip is searched.
+	maxCutSpan = 15 * 60 * 1000
+)
+
+// fingerprint is the sequence of sub-fingerprints of a signal.
+type fingerprint struct {
+	words []uint32
+	// hopMs is the duration of a word in milliseconds.
+	hopMs float64
+	// lengthMs is the duration of the signal; the words cover all but the
+	// last window of it.
+	lengthMs float64
+}
+
+// fingerprinter computes the fingerprint of a stream of stereo samples.
+type fingerprinter struct {
+	decimation int
+	rate       float64
+	sum        float64
+	count      int
+	samples    int
+	window     []float64
+	previous   []float64
+	edges      []int
+	words      []uint32
+}
+
+func newFingerprinter(sampleRate int) *fingerprinter {
+	f := &fingerprinter{decimation: max(1, int(math.Round(float64(sampleRate)/fingerprintRate)))}
+	f.rate = float64(sampleRate) / float64(f.decimation)
+	// Band edges as FFT bins, at least one bin per band.
+	f.edges = make([]int, fingerprintBands+1)
+	for i := range f.edges {
+		freq := 300 * math.Pow(2700.0/300, float64(i)/fingerprintBands)
+		f.edges[i] = int(freq * fingerprintWindow / f.rate)
+		if i > 0 && f.edges[i] <= f.edges[i-1] {
+			f.edges[i] = f.edges[i-1] + 1
+		}
+	}
+	return f
+}
+
+func (f *fingerprinter) add(left, right float64) {
+	// Averaging before decimating keeps the aliasing out of the bands.
+	f.sum += (left + right) / 2
+	f.count++
+	f.samples++
+	if f.count < f.decimation {
+		return
+	}
+	f.window = append(f.window, f.sum/float64(f.count))
+	f.sum, f.count = 0, 0
+	if len(f.window) == fingerprintWindow {
+		f.frame()
+		f.window = append(f.window[:0], f.window[fingerprintHop:]...)
+	}
+}
+
+func (f *fingerprinter) frame() {
+	spectrum := make([]complex128, fingerprintWindow)
+	for i, x := range f.window {
+		hann := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/fingerprintWindow)
+		spectrum[i] = complex(x*hann, 0)
+	}
+	fft(spectrum)
+
+	energies := make([]float64, fingerprintBands)
+	for band := range energies {
+		for bin := f.edges[band]; bin < f.edges[band+1]; bin++ {
+			energies[band] += real(spectrum[bin])*real(spectrum[bin]) + imag(spectrum[bin])*imag(spectrum[bin])
+		}
+	}
+	if f.previous != nil {
+		var word uint32
+		for m := 0; m < fingerprintBands-1; m++ {
+			if energies[m]-energies[m+1]-(f.previous[m]-f.previous[m+1]) > 0 {
+				word |= 1 << m
+			}
+		}
+		f.words = append(f.words, word)
+	}
+	f.previous = energies
+}
+
+func (f *fingerprinter) fingerprint() fingerprint {
+	return fingerprint{
+		words:    f.words,
+		hopMs:    fingerprintHop * 1000 / f.rate,
+		lengthMs: float64(f.samples) * 1000 / (f.rate * float64(f.decimation)),
+	}
+}
+
+// fft is an in-place radix-2 Cooley-Tukey FFT; len(x) must be a power of 2.
+func fft(x []complex128) {
+	n := len(x)
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a, b := x[start+k], w*x[start+k+size/2]
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
+
+// find returns the word positions where clip occurs in f, best match first
+// within every stretch of overlapping candidates.
+func (f fingerprint) find(clip fingerprint) []int {
+	n := len(clip.words)
+	if n == 0 || n > len(f.words) {
+		return nil
+	}
+	limit := int(matchThreshold * float64(32*n))
+
+	var matches []int
+	for pos := 0; pos+n <= len(f.words); pos++ {
+		errors := hamming(f.words[pos:pos+n], clip.words, limit)
+		if errors > limit {
+			continue
+		}
+		// Slide on while the match improves.
+		best, bestErrors := pos, errors
+		for next := pos + 1; next < pos+n && next+n <= len(f.words); next++ {
+			if e := hamming(f.words[next:next+n], clip.words, bestErrors); e < bestErrors {
+				best, bestErrors = next, e
+			}
+		}
+		matches = append(matches, best)
+		pos = best + n - 1
+	}
+	return matches
+}
+
+// hamming counts the differing bits of a and b, giving up once above limit.
+func hamming(a, b []uint32, limit int) int {
+	errors := 0
+	for i := range b {
+		errors += bits.OnesCount32(a[i] ^ b[i])
+		if errors > limit {
+			return errors
+		}
+	}
+	return errors
+}
+
+// jingle is a reference clip of the library.
+type jingle struct {
+	name  string
+	print fingerprint
+}
+
+// jingleLibrary holds the reference clips of a -jingles directory. Clips named
+// *-start.mp3 and *-end.mp3 (e.g. news-start.mp3, news-end.mp3) cut everything
+// from the start clip to the following end clip; every other clip (e.g. an ad
+// jingle) cuts just itself.
+type jingleLibrary struct {
+	starts map[string]jingle // by pair name
+	ends   map[string]jingle
+	single []jingle
+}
+
+func (l jingleLibrary) empty() bool {
+	return len(l.starts) == 0 && len(l.single) == 0
+}
+
+// loadJingles fingerprints every mp3 in dir.
+func loadJingles(dir string) (jingleLibrary, error) {
+	library := jingleLibrary{starts: map[string]jingle{}, ends: map[string]jingle{}}
+	files, err := filepath.Glob(filepath.Join(dir, "*.mp3"))
+	if err != nil {
+		return library, err
+	}
+	if len(files) == 0 {
+		return library, fmt.Errorf("no mp3 reference clips in %s", dir)
+	}
+	for _, file := range files {
+		print, err := fingerprintFile(file)
+		if err != nil {
+			return library, fmt.Errorf("%s: %w", file, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(file), ".mp3")
+		switch {
+		case strings.HasSuffix(name, "-start"):
+			library.starts[strings.TrimSuffix(name, "-start")] = jingle{name, print}
+		case strings.HasSuffix(name, "-end"):
+			library.ends[strings.TrimSuffix(name, "-end")] = jingle{name, print}
+		default:
+			library.single = append(library.single, jingle{name, print})
+		}
+	}
+	for pair, start := range library.starts {
+		if _, ok := library.ends[pair]; !ok {
+			return library, fmt.Errorf("reference clip %s has no %s-end.mp3", start.name, pair)
+		}
+	}
+	return library, nil
+}
+
+func fingerprintFile(path string) (fingerprint, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return fingerprint{}, err
+	}
+	defer file.Close()
+	decoder, err := newPcmDecoder(bufio.NewReader(file))
+	if err != nil {
+		return fingerprint{}, err
+	}
+	f := newFingerprinter(decoder.SampleRate())
+	err = decoder.each(f.add)
+	return f.fingerprint(), err
+}
+
+// cuts returns the intervals the library matches in a stream starting at
+// streamStart, in absolute milliseconds.
+func (l jingleLibrary) cuts(stream fingerprint, streamStart int64) []cut {
+	at := func(pos int) int64 { return streamStart + int64(float64(pos)*stream.hopMs) }
+	length := func(j jingle) int64 { return int64(j.print.lengthMs) }
+
+	var cuts []cut
+	for _, j := range l.single {
+		for _, pos := range stream.find(j.print) {
+			cuts = append(cuts, cut{at(pos), at(pos) + length(j)})
+		}
+	}
+	for pair, start := range l.starts {
+		end := l.ends[pair]
+		ends := stream.find(end.print)
+		for _, pos := range stream.find(start.print) {
+			i := sort.SearchInts(ends, pos+len(start.print.words))
+			if i == len(ends) || at(ends[i])-at(pos) > maxCutSpan {
+				slog.Warn("No matching end clip, not cutting", "clip", start.name, "at", at(pos)-streamStart)
+				continue
+			}
+			cuts = append(cuts, cut{at(pos), at(ends[i]) + length(end)})
+		}
+	}
+	return cuts
+}
+
+// minItemCoverage is the share of the stream the items must cover for the
+// item metadata to count as complete. Below it the jingles cut instead.
+const minItemCoverage = 0.5
+
+// itemsIncomplete reports whether the item metadata of show is missing or
+// covers less than minItemCoverage of the stream.
+func itemsIncomplete(show Show) bool {
+	if len(show.Streams) == 0 {
+		return false
+	}
+	streamStart, streamEnd := show.Streams[0].Start, show.Streams[0].End
+	if streamEnd <= streamStart {
+		return false
+	}
+	items := make([]cut, 0, len(show.Items))
+	for _, item := range show.Items {
+		items = append(items, cut{max(item.Start, streamStart), min(item.End, streamEnd)})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].start < items[j].start })
+	var covered int64
+	cursor := streamStart
+	for _, item := range items {
+		start := max(item.start, cursor)
+		if item.end > start {
+			covered += item.end - start
+			cursor = item.end
+		}
+	}
+	return float64(covered) < minItemCoverage*float64(streamEnd-streamStart)
+}
+
+// downloadJingleCut downloads the whole stream of a broadcast with missing or
+// incomplete item metadata, matches the library in the download and cuts the
+// matches out of it locally, so no audio is fetched twice. Returns the path
+// and the kept segments, nil if the whole stream was kept.
+func downloadJingleCut(show Show, opts downloadOptions, outDir string, filename string) (string, []segment) {
+	logError(makeDirectoryIfNotExisting(outDir))
+	path := outDir + "/" + filename
+	streamPath := path + ".stream"
+	defer func() { _ = os.Remove(streamPath) }()
+	logError(downloadSegments([]string{getDownloadUrl(show)}, filename, streamPath))
+
+	segs := refineSegments(show, jingleSegments(show, opts.jingles, streamPath), opts.refineCuts)
+	if len(segs) == 0 {
+		logError(os.Rename(streamPath, path))
+		return path, nil
+	}
+	partPath := path + ".part"
+	logError(cutFrames(streamPath, partPath, segs))
+	logError(os.Rename(partPath, path))
+	return path, segs
+}
+
+// jingleSegments fingerprints the downloaded stream of show and returns the
+// ranges kept around what the library and the removed items cover.
+func jingleSegments(show Show, library jingleLibrary, streamPath string) []segment {
+	slog.Info("Item metadata missing or incomplete, matching reference clips", "title", show.Title, "broadcastDay", show.BroadcastDay)
+	stream, err := fingerprintFile(streamPath)
+	if err != nil {
+		slog.Warn("Could not match reference clips, cutting by the items only", "error", err)
+		return contentSegments(show)
+	}
+	cuts := library.cuts(stream, show.Streams[0].Start)
+	slog.Info("Matched reference clips", "title", show.Title, "cuts", len(cuts))
+	return keepSegments(show, append(itemCuts(show), cuts...))
+}
+
+// cutFrames copies the mp3 frames of src starting within one of segs to dst,
+// so the cut needs no re-encoding. A leading ID3v2 tag is dropped. On failure
+// dst is removed.
+func cutFrames(src string, dst string, segs []segment) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			_ = os.Remove(dst)
+		}
+	}()
+
+	r := bufio.NewReaderSize(in, 64*1024)
+	w := bufio.NewWriter(out)
+	if header, err := r.Peek(10); err == nil {
+		if _, err := r.Discard(int(id3v2Size(header))); err != nil {
+			return err
+		}
+	}
+	var position float64 // ms
+	for len(segs) > 0 {
+		header, err := r.Peek(4)
+		if len(header) < 4 {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		length, _ := frameHeader(header)
+		if length == 0 {
+			if _, err := r.Discard(1); err != nil {
+				return err
+			}
+			continue
+		}
+		frame, err := r.Peek(length)
+		if err == io.EOF {
+			// A truncated last frame.
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for len(segs) > 0 && position >= float64(segs[0].offsetEnd) {
+			segs = segs[1:]
+		}
+		if len(segs) > 0 && position >= float64(segs[0].offset) {
+			if _, err := w.Write(frame); err != nil {
+				return err
+			}
+		}
+		position += frameDuration(header)
+		if _, err := r.Discard(length); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+func fingerprintStream(url string) (fingerprint, error) {
+	decoder, body, err := openStream(url)
+	if err != nil {
+		return fingerprint{}, err
+	}
+	defer body.Close()
+	f := newFingerprinter(decoder.SampleRate())
+	err = decoder.each(f.add)
+	return f.fingerprint(), err
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestFFT(t *testing.T) {
+	x := make([]complex128, 16)
+	for i := range x {
+		x[i] = complex(math.Cos(2*math.Pi*3*float64(i)/16), 0)
+	}
+	fft(x)
+	for k, v := range x {
+		want := 0.0
+		if k == 3 || k == 13 {
+			want = 8
+		}
+		if math.Abs(cmplx.Abs(v)-want) > 1e-9 {
+			t.Errorf("bin %d got %.3f want %.0f", k, cmplx.Abs(v), want)
+		}
+	}
+}
+
+type stereo [2]float64
+
+func decodeTestdata(t *testing.T) ([]stereo, int) {
+	t.Helper()
+	file, err := os.Open("../_testdata/show.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	decoder, err := newPcmDecoder(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var samples []stereo
+	err = decoder.each(func(left, right float64) { samples = append(samples, stereo{left, right}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return samples, decoder.SampleRate()
+}
+
+func fingerprintSamples(samples []stereo, rate int) fingerprint {
+	f := newFingerprinter(rate)
+	for _, s := range samples {
+		f.add(s[0], s[1])
+	}
+	return f.fingerprint()
+}
+
+func TestFingerprintFind(t *testing.T) {
+	samples, rate := decodeTestdata(t)
+	stream := fingerprintSamples(samples, rate)
+
+	clip := fingerprintSamples(samples[5*rate:8*rate], rate)
+	matches := stream.find(clip)
+	if len(matches) != 1 {
+		t.Fatalf("got matches %v want one", matches)
+	}
+	if at := float64(matches[0]) * stream.hopMs; math.Abs(at-5000) > 2*stream.hopMs {
+		t.Errorf("matched at %.0fms want 5000ms", at)
+	}
+
+	noise := make([]stereo, 3*rate)
+	rnd := rand.New(rand.NewSource(1))
+	for i := range noise {
+		noise[i] = stereo{rnd.Float64() - 0.5, rnd.Float64() - 0.5}
+	}
+	if matches := stream.find(fingerprintSamples(noise, rate)); len(matches) != 0 {
+		t.Errorf("noise matched at %v", matches)
+	}
+}
+
+func TestDownloadJingleCut(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://loopstreamfm4\.apa\.at`),
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewBytesResponse(200, httpmock.File("../_testdata/show.mp3").Bytes()), nil
+		},
+	)
+
+	samples, rate := decodeTestdata(t)
+	clip := func(from, to int) jingle {
+		return jingle{print: fingerprintSamples(samples[from*rate:to*rate], rate)}
+	}
+	library := jingleLibrary{
+		starts: map[string]jingle{"news": clip(2, 4)},
+		ends:   map[string]jingle{"news": clip(7, 9)},
+		single: []jingle{clip(14, 16)},
+	}
+
+	show := Show{
+		Streams: []Streams{{
+			Start:       1000000,
+			End:         1020000,
+			Progressive: "https://loopstreamfm4.apa.at/?channel=fm4&id=show.mp3",
+		}},
+		// The few items there are still cut.
+		Items: []Items{{Type: "W", Start: 1018500, End: 1019500}},
+	}
+	outDir := t.TempDir()
+	file, got := downloadJingleCut(show, downloadOptions{jingles: library}, outDir, "show.mp3")
+
+	// Kept: 0-2s, 9-14s and 16s to the end but the ad, each within a few hops.
+	want := []segment{{0, 2000}, {9000, 14000}, {16000, 18500}, {19500, 20000}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v want %+v", got, want)
+	}
+	var kept int64
+	for i := range want {
+		if math.Abs(float64(got[i].offset-want[i].offset)) > 100 || math.Abs(float64(got[i].offsetEnd-want[i].offsetEnd)) > 100 {
+			t.Errorf("segment %d got %+v want %+v", i, got[i], want[i])
+		}
+		kept += got[i].offsetEnd - got[i].offset
+	}
+
+	if calls := httpmock.GetTotalCallCount(); calls != 1 {
+		t.Errorf("expected the stream to be downloaded once, got %d requests", calls)
+	}
+	print, err := fingerprintFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(print.lengthMs-float64(kept)) > 200 {
+		t.Errorf("cut episode lasts %.0fms want %dms", print.lengthMs, kept)
+	}
+	if files, _ := os.ReadDir(outDir); len(files) != 1 {
+		t.Errorf("expected only the episode to be left, got %v", files)
+	}
+}
+
+func TestItemsIncomplete(t *testing.T) {
+	streams := []Streams{{Start: 0, End: 100000}}
+	tests := []struct {
+		name  string
+		items []Items
+		want  bool
+	}{
+		{"missing", nil, true},
+		{"sparse", []Items{{Start: 0, End: 10000}, {Start: 50000, End: 60000}}, true},
+		{"overlapping", []Items{{Start: 0, End: 40000}, {Start: 20000, End: 45000}}, true},
+		{"outside the stream", []Items{{Start: -60000, End: 10000}, {Start: 90000, End: 160000}}, true},
+		{"complete", []Items{{Start: 0, End: 30000}, {Start: 32000, End: 100000}}, false},
+		{"half", []Items{{Start: 25000, End: 75000}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := itemsIncomplete(Show{Streams: streams, Items: tt.items}); got != tt.want {
+				t.Errorf("got %v want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadJingles(t *testing.T) {
+	dir := t.TempDir()
+	mp3 := httpmock.File("../_testdata/show.mp3").Bytes()
+	for _, name := range []string{"news-start.mp3", "news-end.mp3", "ad.mp3"} {
+		if err := os.WriteFile(path.Join(dir, name), mp3, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	library, err := loadJingles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(library.starts) != 1 || len(library.ends) != 1 || len(library.single) != 1 || library.empty() {
+		t.Errorf("unexpected library %+v", library)
+	}
+
+	if err := os.Remove(path.Join(dir, "news-end.mp3")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadJingles(dir); err == nil || !strings.Contains(err.Error(), "news-end.mp3") {
+		t.Errorf("expected a missing end clip error, got %v", err)
+	}
+	if _, err := loadJingles(t.TempDir()); err == nil {
+		t.Error("expected an error for an empty directory")
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// episode is a broadcast of a show as seen by the 'list' subcommand: the
+// API's view of it plus where it is (or would be) stored in the archive.
+type episode struct {
+	broadcastSummary
+	Path     string `json:"path"`
+	Archived bool   `json:"archived"`
+}
+
+// List prints the episodes of the referenced show (Sendung URL, programKey or
+// name) that are currently available, including their expiry and whether they
+// are already present below destDir.
+func List(showRef string, destDir string, format string) {
+	programKey := resolveShowRef(showRef)
+	if programKey == "" {
+		return
+	}
+
+	episodes := listEpisodes(programKey, destDir)
+
+	err := printEpisodes(os.Stdout, episodes, format)
+	logError(err)
+}
+
+// listEpisodes fetches every episode of the program. The episode list lacks the
+// start time and expiry, so each episode's broadcast/{id} is fetched as well.
+func listEpisodes(programKey string, destDir string) []episode {
+	var episodes []episode
+	for _, summary := range getProgramBroadcasts(programKey) {
+		broadcast := getBroadcast(summary.Href)
+		show := createShow(broadcast)
+
+		path := getFilePath(destDir, show)
+		archived, err := fileExists(path)
+		logError(err)
+
+		episodes = append(episodes, episode{
+			broadcastSummary: broadcast.toSummary(),
+			Path:             path,
+			Archived:         archived,
+		})
+	}
+	return episodes
+}
+
+func printEpisodes(w io.Writer, episodes []episode, format string) error {
+	switch format {
+	case "", "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "DAY\tSTART\tMIN\tSTATE\tON-DEMAND\tGEO\tEXPIRES\tARCHIVED\tTITLE")
+		for _, e := range episodes {
+			_, _ = fmt.Fprintf(tw, "%d\t%s\t%d\t%s\t%t\t%t\t%s\t%t\t%s\n",
+				e.BroadcastDay, e.Start.Local().Format("Mon 15:04"), int64(e.duration().Minutes()),
+				e.State, e.IsOnDemand, e.IsGeoProtected, formatExpiry(e.Expiry), e.Archived, e.Title)
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if episodes == nil {
+			episodes = []episode{}
+		}
+		return enc.Encode(episodes)
+	default:
+		return fmt.Errorf("unknown format %q, expected table or json", format)
+	}
+}
+
+func formatExpiry(expiry time.Time) string {
+	if expiry.IsZero() {
+		return "-"
+	}
+	return expiry.Local().Format(YYYYMMDD + " 15:04")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestListEpisodes(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/5.0/broadcasts/program/4DD",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/program_4DD.json"))
+		},
+	)
+	for _, id := range []string{"42628", "42536"} {
+		httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/"+id+"?items=1000",
+			func(req *http.Request) (*http.Response, error) {
+				return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/broadcast_42628_full_v5.json"))
+			},
+		)
+	}
+
+	destDir := t.TempDir()
+	// Pretend the first episode has already been archived.
+	archived := path.Join(destDir, "Davidecks", "2026", "Davidecks_20260620.mp3")
+	if err := os.MkdirAll(path.Dir(archived), 0755); err != nil {
+		t.Fatal(err)
+	}
+	copyFile("../_testdata/show.mp3", archived)
+
+	got := listEpisodes("4DD", destDir)
+
+	if len(got) != 2 {
+		t.Fatalf("got %d episodes, want 2", len(got))
+	}
+	if !got[0].Archived || got[0].Path != archived {
+		t.Errorf("episode 0: archived=%v path=%q, want archived at %q", got[0].Archived, got[0].Path, archived)
+	}
+	wantExpiry := time.Date(2026, 7, 20, 16, 59, 36, 0, time.UTC)
+	if !got[0].Expiry.Equal(wantExpiry) {
+		t.Errorf("expiry got %s want %s", got[0].Expiry, wantExpiry)
+	}
+	if got[0].Duration != 7203000 {
+		t.Errorf("duration got %d want %d", got[0].Duration, 7203000)
+	}
+
+	var out bytes.Buffer
+	if err := printEpisodes(&out, got, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded[0]["expiry"] != "2026-07-20T16:59:36Z" || decoded[0]["archived"] != true {
+		t.Errorf("json got %v", decoded[0])
+	}
+
+	out.Reset()
+	if err := printEpisodes(&out, got, "table"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "EXPIRES") || strings.Count(out.String(), "\n") != 3 {
+		t.Errorf("table got %q", out.String())
+	}
+}
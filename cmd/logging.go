@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// showProgress enables the download progress bars. They are hidden when
+// logging quietly or as JSON, where they would garble the output.
+var showProgress = true
+
+// exit terminates the process; tests replace it to observe the exit status.
+var exit = os.Exit
+
+// fatalMessage is the message of the fatal error being handled, for exit hooks
+// that report it.
+var fatalMessage string
+
+// exitHooks run before fatal terminates the process, e.g. to still write the
+// run report of a run that failed half-way.
+var exitHooks []func()
+
+// setupLogging installs the default slog logger. Each line carries its own
+// timestamp and level; format is "text" or "json".
+func setupLogging(w io.Writer, format string, level slog.Level) {
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch format {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		fatal("unknown log format, expected text or json", "format", format)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	showProgress = format != "json" && level <= slog.LevelInfo
+}
+
+// logFlags registers the logging flags on a subcommand.
+type logFlags struct {
+	format  *string
+	quiet   *bool
+	verbose *bool
+}
+
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	return &logFlags{
+		format:  fs.String("log-format", "text", "Log format: text or json"),
+		quiet:   fs.Bool("quiet", false, "Only log warnings and errors"),
+		verbose: fs.Bool("verbose", false, "Log debug details"),
+	}
+}
+
+// setup applies the parsed logging flags.
+func (f *logFlags) setup() {
+	level := slog.LevelInfo
+	if *f.verbose {
+		level = slog.LevelDebug
+	}
+	if *f.quiet {
+		level = slog.LevelWarn
+	}
+	setupLogging(os.Stderr, *f.format, level)
+}
+
+// fatal logs msg with its key-value attributes as an error, runs the exit
+// hooks and exits, or aborts just the current run inside runOnce.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	fatalMessage = msg
+	for i := 0; i+1 < len(args); i += 2 {
+		fatalMessage += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+	for _, hook := range exitHooks {
+		hook()
+	}
+	if abortingRuns.Load() {
+		panic(errRunAborted)
+	}
+	exit(1)
+}
+
+// fatalf is fatal for messages that are only a formatted string.
+func fatalf(format string, args ...any) {
+	fatal(fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+)
+
+func TestSetupLoggingJSON(t *testing.T) {
+	defer func(l *slog.Logger, progress bool) {
+		slog.SetDefault(l)
+		showProgress = progress
+	}(slog.Default(), showProgress)
+
+	var out bytes.Buffer
+	setupLogging(&out, "json", slog.LevelWarn)
+
+	slog.Info("hidden below the level")
+	slog.Warn("Episode expires soon", "broadcastDay", 20260620)
+
+	var line map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &line); err != nil {
+		t.Fatalf("expected a single JSON line, got %q: %v", out.String(), err)
+	}
+	if line["level"] != "WARN" || line["broadcastDay"] != float64(20260620) || line["time"] == nil {
+		t.Errorf("got %v", line)
+	}
+	if showProgress {
+		t.Error("progress bars must be off for JSON logging")
+	}
+}
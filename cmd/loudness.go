@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bogem/id3v2"
+)
+
+// replayGainReference is the ReplayGain 2.0 reference loudness in LUFS.
+const replayGainReference = -18.0
+
+// loudness is the EBU R128 measurement of an episode.
+type loudness struct {
+	Integrated float64 `json:"integrated"` // LUFS
+	TruePeak   float64 `json:"truePeak"`   // dBTP
+	Length     int64   `json:"length"`     // milliseconds of audio measured
+}
+
+func (l loudness) gain() float64 {
+	return replayGainReference - l.Integrated
+}
+
+func (l loudness) peak() float64 {
+	return math.Pow(10, l.TruePeak/20)
+}
+
+// analyseMp3 decodes the mp3 at path and measures its loudness.
+func analyseMp3(path string) (loudness, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return loudness{}, err
+	}
+	defer file.Close()
+
+	decoder, err := newPcmDecoder(bufio.NewReader(file))
+	if err != nil {
+		return loudness{}, err
+	}
+	meter := newR128Meter(decoder.SampleRate())
+	if err := decoder.each(meter.add); err != nil {
+		return loudness{}, err
+	}
+	return meter.result(), nil
+}
+
+// biquad is a second order IIR filter in direct form I.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// kWeighting returns the two ITU-R BS.1770 K-weighting stages, a high shelf
+// and a high pass, for the given sample rate.
+func kWeighting(sampleRate int) (shelf, highPass biquad) {
+	fs := float64(sampleRate)
+
+	f0, gain, q := 1681.974450955533, 3.999843853973347, 0.7071752369554196
+	k := math.Tan(math.Pi * f0 / fs)
+	vh := math.Pow(10, gain/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf = biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	f0, q = 38.13547087602444, 0.5003270373238773
+	k = math.Tan(math.Pi * f0 / fs)
+	a0 = 1 + k/q + k*k
+	highPass = biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+	return shelf, highPass
+}
+
+// r128Meter measures integrated loudness and true peak of a stereo signal
+// following EBU R128 / ITU-R BS.1770-4.
+type r128Meter struct {
+	sampleRate int
+	filters    [2][2]biquad
+	peaks      [2]truePeakMeter
+
+	// The signal is summed up in 100ms steps; four steps form a 400ms
+	// gating block, so consecutive blocks overlap by 75%.
+	stepLength int
+	stepCount  int
+	stepSum    float64
+	steps      []float64
+	samples    int64
+}
+
+func newR128Meter(sampleRate int) *r128Meter {
+	m := &r128Meter{sampleRate: sampleRate, stepLength: sampleRate / 10}
+	for ch := range m.filters {
+		shelf, highPass := kWeighting(sampleRate)
+		m.filters[ch] = [2]biquad{shelf, highPass}
+	}
+	return m
+}
+
+func (m *r128Meter) add(left, right float64) {
+	for ch, x := range [2]float64{left, right} {
+		m.peaks[ch].add(x)
+		y := m.filters[ch][1].process(m.filters[ch][0].process(x))
+		m.stepSum += y * y
+	}
+	m.samples++
+	m.stepCount++
+	if m.stepCount == m.stepLength {
+		m.steps = append(m.steps, m.stepSum/float64(m.stepLength))
+		m.stepSum, m.stepCount = 0, 0
+	}
+}
+
+func (m *r128Meter) result() loudness {
+	// Mean square power of each 400ms block, channel weights are 1 for L/R.
+	var blocks []float64
+	for i := 3; i < len(m.steps); i++ {
+		blocks = append(blocks, (m.steps[i-3]+m.steps[i-2]+m.steps[i-1]+m.steps[i])/4)
+	}
+
+	// Absolute gate at -70 LUFS, then relative gate 10 LU below the loudness
+	// of the blocks that passed the absolute gate.
+	gated := gate(blocks, loudnessToPower(-70))
+	integrated := math.Inf(-1)
+	if len(gated) > 0 {
+		gated = gate(gated, mean(gated)*math.Pow(10, -1))
+		integrated = powerToLoudness(mean(gated))
+	}
+
+	peak := math.Max(m.peaks[0].peak, m.peaks[1].peak)
+	return loudness{
+		Integrated: integrated,
+		TruePeak:   20 * math.Log10(peak),
+		Length:     m.samples * 1000 / int64(m.sampleRate),
+	}
+}
+
+func gate(blocks []float64, threshold float64) []float64 {
+	var passed []float64
+	for _, b := range blocks {
+		if b > threshold {
+			passed = append(passed, b)
+		}
+	}
+	return passed
+}
+
+func mean(values []float64) float64 {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func powerToLoudness(power float64) float64 {
+	return -0.691 + 10*math.Log10(power)
+}
+
+func loudnessToPower(lufs float64) float64 {
+	return math.Pow(10, (lufs+0.691)/10)
+}
+
+// True peaks are measured by 4x oversampling with a windowed sinc
+// interpolation filter, as suggested by BS.1770-4 Annex 2.
+const (
+	oversampling = 4
+	phaseTaps    = 12
+)
+
+var interpolationFilter, interpolationGain = func() ([oversampling][phaseTaps]float64, float64) {
+	var h [oversampling][phaseTaps]float64
+	var gain float64
+	n := oversampling * phaseTaps
+	for i := 0; i < n; i++ {
+		t := float64(i-n/2) / oversampling
+		sinc := 1.0
+		if t != 0 {
+			sinc = math.Sin(math.Pi*t) / (math.Pi * t)
+		}
+		window := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n))
+		h[i%oversampling][i/oversampling] = sinc * window
+	}
+	for _, phase := range h {
+		var sum float64
+		for _, v := range phase {
+			sum += math.Abs(v)
+		}
+		gain = math.Max(gain, sum)
+	}
+	return h, gain
+}()
+
+type truePeakMeter struct {
+	history [phaseTaps]float64
+	pos     int
+	// loud is how many more samples may still produce an interpolated value
+	// above the current peak.
+	loud int
+	peak float64
+}
+
+func (m *truePeakMeter) add(x float64) {
+	m.pos = (m.pos + 1) % phaseTaps
+	m.history[m.pos] = x
+
+	if math.Abs(x) > m.peak {
+		m.peak = math.Abs(x)
+	}
+	// No interpolated value can exceed the largest sample in the filter
+	// window times the filter gain, so quiet stretches are skipped.
+	if math.Abs(x)*interpolationGain > m.peak {
+		m.loud = phaseTaps
+	}
+	if m.loud == 0 {
+		return
+	}
+	m.loud--
+
+	for _, phase := range interpolationFilter {
+		var y float64
+		for k, h := range phase {
+			y += h * m.history[(m.pos-k+phaseTaps)%phaseTaps]
+		}
+		if math.Abs(y) > m.peak {
+			m.peak = math.Abs(y)
+		}
+	}
+}
+
+// ReplayGain frames written to the mp3.
+const (
+	trackGainFrame = "REPLAYGAIN_TRACK_GAIN"
+	trackPeakFrame = "REPLAYGAIN_TRACK_PEAK"
+	albumGainFrame = "REPLAYGAIN_ALBUM_GAIN"
+	albumPeakFrame = "REPLAYGAIN_ALBUM_PEAK"
+)
+
+// readLoudness recovers the measurement from the ReplayGain and TLEN frames
+// of an analysed mp3.
+func readLoudness(tag *id3v2.Tag) (loudness, bool) {
+	values := userDefinedTexts(tag)
+	gain, err1 := strconv.ParseFloat(strings.TrimSuffix(values[trackGainFrame], " dB"), 64)
+	peak, err2 := strconv.ParseFloat(values[trackPeakFrame], 64)
+	length, err3 := strconv.ParseInt(tag.GetTextFrame("TLEN").Text, 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil {
+		return loudness{}, false
+	}
+	return loudness{
+		Integrated: replayGainReference - gain,
+		TruePeak:   20 * math.Log10(peak),
+		Length:     length,
+	}, true
+}
+
+// albumLoudness combines the tracks of an album weighted by their length. This
+// approximates measuring them as one stream, without decoding them again.
+func albumLoudness(tracks []loudness) loudness {
+	var album loudness
+	var power float64
+	album.TruePeak = math.Inf(-1)
+	for _, t := range tracks {
+		power += float64(t.Length) * loudnessToPower(t.Integrated)
+		album.Length += t.Length
+		album.TruePeak = math.Max(album.TruePeak, t.TruePeak)
+	}
+	album.Integrated = powerToLoudness(power / float64(album.Length))
+	return album
+}
+
+// loudnessStage measures new episodes and writes the ReplayGain tags. The
+// album is every analysed episode in the same directory, i.e. show and year.
+type loudnessStage struct{}
+
+func (loudnessStage) name() string { return "replaygain" }
+
+func (loudnessStage) run(ep *processedEpisode) error {
+	track, analysed := readLoudnessFile(ep.path)
+	if !analysed || !ep.existing {
+		var err error
+		if track, err = analyseMp3(ep.path); err != nil {
+			return err
+		}
+		if math.IsInf(track.Integrated, -1) {
+			return fmt.Errorf("%s is silent", ep.path)
+		}
+		slog.Info("Measured loudness", "path", ep.path,
+			"integrated", fmt.Sprintf("%.1f LUFS", track.Integrated),
+			"truePeak", fmt.Sprintf("%.1f dBTP", track.TruePeak))
+	}
+	ep.report.Loudness = &track
+
+	tracks := []loudness{track}
+	siblings, err := filepath.Glob(filepath.Join(filepath.Dir(ep.path), "*.mp3"))
+	if err != nil {
+		return err
+	}
+	for _, sibling := range siblings {
+		if sibling == ep.path {
+			continue
+		}
+		if l, ok := readLoudnessFile(sibling); ok {
+			tracks = append(tracks, l)
+		}
+	}
+	album := albumLoudness(tracks)
+
+	tag, err := id3v2.Open(ep.path, id3v2.Options{Parse: true})
+	if err != nil {
+		return err
+	}
+	defer tag.Close()
+	values := map[string]string{
+		trackGainFrame: fmt.Sprintf("%.2f dB", track.gain()),
+		trackPeakFrame: fmt.Sprintf("%.6f", track.peak()),
+		albumGainFrame: fmt.Sprintf("%.2f dB", album.gain()),
+		albumPeakFrame: fmt.Sprintf("%.6f", album.peak()),
+	}
+	length := strconv.FormatInt(track.Length, 10)
+	// Archived episodes are only rewritten when the album gain moved, e.g.
+	// because a new episode joined the album.
+	current := userDefinedTexts(tag)
+	upToDate := ep.existing && tag.GetTextFrame("TLEN").Text == length
+	for description, value := range values {
+		upToDate = upToDate && current[description] == value
+	}
+	if upToDate {
+		return nil
+	}
+	for description, value := range values {
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: description,
+			Value:       value,
+		})
+	}
+	tag.AddTextFrame("TLEN", id3v2.EncodingUTF8, length)
+	ep.retagged = ep.retagged || ep.existing
+	return tag.Save()
+}
+
+func readLoudnessFile(path string) (loudness, bool) {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true, ParseFrames: []string{"TXXX", "TLEN"}})
+	if err != nil {
+		return loudness{}, false
+	}
+	defer tag.Close()
+	return readLoudness(tag)
+}
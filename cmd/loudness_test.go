@@ -0,0 +1,120 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2"
+	"github.com/jarcoal/httpmock"
+)
+
+func measureSine(sampleRate int, frequency, amplitude, phase float64, seconds int) loudness {
+	meter := newR128Meter(sampleRate)
+	for n := 0; n < sampleRate*seconds; n++ {
+		x := amplitude * math.Sin(2*math.Pi*frequency*float64(n)/float64(sampleRate)+phase)
+		meter.add(x, x)
+	}
+	return meter.result()
+}
+
+func TestR128Loudness(t *testing.T) {
+	// A 997 Hz sine at -20 dBFS in both channels reads -20 LUFS.
+	for _, rate := range []int{44100, 48000} {
+		got := measureSine(rate, 997, 0.1, 0, 5)
+		if math.Abs(got.Integrated+20) > 0.1 {
+			t.Errorf("%d Hz: integrated got %.2f LUFS want -20", rate, got.Integrated)
+		}
+		if got.Length != 5000 {
+			t.Errorf("%d Hz: length got %d want 5000", rate, got.Length)
+		}
+	}
+
+	// Sampled at fs/4 with a 45° phase the samples miss the crests by 3 dB;
+	// the true peak still finds them.
+	got := measureSine(48000, 12000, 0.5, math.Pi/4, 1)
+	if want := 20 * math.Log10(0.5); math.Abs(got.TruePeak-want) > 0.2 {
+		t.Errorf("true peak got %.2f dBTP want %.2f", got.TruePeak, want)
+	}
+
+	silence := newR128Meter(48000)
+	for n := 0; n < 48000; n++ {
+		silence.add(0, 0)
+	}
+	if l := silence.result(); !math.IsInf(l.Integrated, -1) {
+		t.Errorf("silence got %.2f LUFS", l.Integrated)
+	}
+}
+
+func TestAlbumLoudness(t *testing.T) {
+	album := albumLoudness([]loudness{
+		{Integrated: -20, TruePeak: -3, Length: 3000},
+		{Integrated: -10, TruePeak: -1, Length: 1000},
+	})
+	// 3/4 of the time at -20 LUFS and 1/4 at -10 LUFS.
+	want := powerToLoudness(0.75*loudnessToPower(-20) + 0.25*loudnessToPower(-10))
+	if math.Abs(album.Integrated-want) > 1e-9 || album.TruePeak != -1 || album.Length != 4000 {
+		t.Errorf("got %+v want integrated %.2f, true peak -1, length 4000", album, want)
+	}
+}
+
+func TestReplayGainTags(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	broadcastUrl := registerDavidecksDownload()
+
+	destDir := t.TempDir()
+	reportFile := path.Join(t.TempDir(), "report.json")
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{report: reportFile, replayGain: true})
+
+	episode := readReport(t, reportFile).Episodes[0]
+	if episode.Loudness == nil {
+		t.Fatalf("expected a loudness measurement, got %+v", episode)
+	}
+	if l := *episode.Loudness; l.Integrated > 0 || l.Integrated < -70 || l.Length == 0 {
+		t.Errorf("implausible measurement %+v", l)
+	}
+
+	// Re-tagging keeps the ReplayGain frames and the measurement is reused.
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{report: reportFile})
+	tagged, ok := readLoudnessFile(episode.Path)
+	if !ok {
+		t.Fatal("expected the ReplayGain frames to survive re-tagging")
+	}
+	if math.Abs(tagged.Integrated-episode.Loudness.Integrated) > 0.01 || tagged.Length != episode.Loudness.Length {
+		t.Errorf("tags got %+v want %+v", tagged, *episode.Loudness)
+	}
+
+	// Unchanged ReplayGain values are not written again.
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(episode.Path, past, past); err != nil {
+		t.Fatal(err)
+	}
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{replayGain: true})
+	if info, err := os.Stat(episode.Path); err != nil || !info.ModTime().Equal(past) {
+		t.Errorf("expected the archived episode to be left alone (%v)", err)
+	}
+
+	tag, err := id3v2.Open(episode.Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	frames := map[string]string{}
+	for _, f := range tag.GetFrames("TXXX") {
+		udtf := f.(id3v2.UserDefinedTextFrame)
+		frames[udtf.Description] = udtf.Value
+	}
+	// A single episode is its own album.
+	if frames[albumGainFrame] != frames[trackGainFrame] || frames[albumPeakFrame] != frames[trackPeakFrame] {
+		t.Errorf("album frames differ from the track frames: %v", frames)
+	}
+	if tag.Title() != "Davidecks - 20260620" {
+		t.Errorf("title got %q", tag.Title())
+	}
+	if n := len(tag.GetFrames(tag.CommonID("Attached picture"))); n != 1 {
+		t.Errorf("got %d pictures want 1", n)
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
@@ -25,21 +25,118 @@ const (
 
 func main() {
 
-	log.SetFlags(log.Lmsgprefix)
-	log.SetPrefix(time.Now().Format(YYYYMMDD+" "+HHMMSS24h) + " >   ")
+	setupLogging(os.Stderr, "text", slog.LevelInfo)
+	setupHttpClient()
 
 	searchCmd := flag.NewFlagSet("search", flag.ExitOnError)
 	searchQuery := searchCmd.String("query", "Davidecks", "-query SEARCHSTRING")
+	searchFilter := addFilterFlags(searchCmd)
+	searchFormat := searchCmd.String("format", "text", "Output format: text, table, json or csv")
+	searchSort := searchCmd.String("sort", "", "Sort hits by date, title or duration (default: API order)")
+	searchReverse := searchCmd.Bool("reverse", false, "Reverse the sort order")
+	searchLimit := searchCmd.Int("limit", 0, "Show at most this many hits (0 = all)")
+	searchInteractive := searchCmd.Bool("interactive", false, "Pick hits to download from a numbered list")
+	searchDestDir := searchCmd.String("out-base-dir", "./music", "Location of your shows (used with -interactive)")
+	searchDownloadFlags := addDownloadFlags(searchCmd)
+	searchLogFlags := addLogFlags(searchCmd)
+	searchCacheFlags := addCacheFlags(searchCmd)
+
+	findSongCmd := flag.NewFlagSet("find-song", flag.ExitOnError)
+	findSongQuery := findSongCmd.String("query", "", "Artist and/or title of the song")
+	findSongFormat := findSongCmd.String("format", "table", "Output format: table or json")
+	findSongDownload := findSongCmd.Bool("download", false, "Download every song found as a clip")
+	findSongInteractive := findSongCmd.Bool("interactive", false, "Pick songs to download from a numbered list")
+	findSongOutDir := findSongCmd.String("out-dir", "./clips", "Where the song clips are stored")
+	findSongLogFlags := addLogFlags(findSongCmd)
+	findSongCacheFlags := addCacheFlags(findSongCmd)
+
+	clipCmd := flag.NewFlagSet("clip", flag.ExitOnError)
+	clipStart := clipCmd.String("start", "", "Start of the clip: HH:MM[:SS], +OFFSET (e.g. +1h15m) or #ITEM (default: broadcast start)")
+	clipEnd := clipCmd.String("end", "", "End of the clip, like -start (default: end of the -start item or the broadcast)")
+	clipTitle := clipCmd.String("title", "", "Title of the clip (default: the item's title or the time range)")
+	clipOutDir := clipCmd.String("out-dir", "./clips", "Where the clips are stored")
+	clipLogFlags := addLogFlags(clipCmd)
+	clipCacheFlags := addCacheFlags(clipCmd)
 
 	downloadCmd := flag.NewFlagSet("download", flag.ExitOnError)
 	showPtr := downloadCmd.String("show", "Davidecks", "Show name")
 	destDirPtr := downloadCmd.String("out-base-dir", "./music", "Location of your shows")
+	downloadFlags := addDownloadFlags(downloadCmd)
+	downloadSelection := addSelectionFlags(downloadCmd)
+	downloadLogFlags := addLogFlags(downloadCmd)
+	downloadCacheFlags := addCacheFlags(downloadCmd)
 
 	urlCmd := flag.NewFlagSet("url", flag.ExitOnError)
 	destDirUrlPtr := urlCmd.String("out-base-dir", "./music", "Location of your shows")
+	urlDownloadFlags := addDownloadFlags(urlCmd)
+	urlSelection := addSelectionFlags(urlCmd)
+	urlLogFlags := addLogFlags(urlCmd)
+	urlCacheFlags := addCacheFlags(urlCmd)
+
+	recordCmd := flag.NewFlagSet("record", flag.ExitOnError)
+	destDirRecordPtr := recordCmd.String("out-base-dir", "./music", "Location of your shows")
+	recordLiveUrl := recordCmd.String("live-url", fm4LiveUrl, "The station's live mp3 stream")
+	recordPreRoll := recordCmd.Duration("pre-roll", time.Minute, "Start recording this long before the scheduled start")
+	recordPostRoll := recordCmd.Duration("post-roll", 2*time.Minute, "Keep recording this long after the scheduled end")
+	recordDays := recordCmd.Int("days", 7, "Search the schedule this many days ahead for the next airing")
+	recordDownloadFlags := addDownloadFlags(recordCmd)
+	recordLogFlags := addLogFlags(recordCmd)
+	recordCacheFlags := addCacheFlags(recordCmd)
+
+	subscribeCmd := flag.NewFlagSet("subscribe", flag.ExitOnError)
+	destDirSubscribePtr := subscribeCmd.String("out-base-dir", "./music", "Location of your shows")
+	subscribeRules := subscribeCmd.String("rules", "", "JSON file of the subscription rules")
+	subscribeDays := subscribeCmd.Int("days", 7, "Match the rules against the schedule of this many days up to today")
+	subscribeDownloadFlags := addDownloadFlags(subscribeCmd)
+	subscribeLogFlags := addLogFlags(subscribeCmd)
+	subscribeCacheFlags := addCacheFlags(subscribeCmd)
+
+	listCmd := flag.NewFlagSet("list", flag.ExitOnError)
+	destDirListPtr := listCmd.String("out-base-dir", "./music", "Location of your shows")
+	listFormat := listCmd.String("format", "table", "Output format: table or json")
+	listLogFlags := addLogFlags(listCmd)
+	listCacheFlags := addCacheFlags(listCmd)
+
+	verifyCmd := flag.NewFlagSet("verify", flag.ExitOnError)
+	destDirVerifyPtr := verifyCmd.String("out-base-dir", "./music", "Location of your shows")
+	verifyFormat := verifyCmd.String("format", "table", "Output format: table or json")
+	verifyRedownload := verifyCmd.Bool("redownload", false, "Download broken episodes again that are still available on demand")
+	verifyDownloadFlags := addDownloadFlags(verifyCmd)
+	verifyLogFlags := addLogFlags(verifyCmd)
+	verifyCacheFlags := addCacheFlags(verifyCmd)
+
+	migrateCmd := flag.NewFlagSet("migrate", flag.ExitOnError)
+	destDirMigratePtr := migrateCmd.String("out-base-dir", "./music", "Location of your shows")
+	migrateDryRun := migrateCmd.Bool("dry-run", false, "Print the moves without making them")
+	migrateMoveLog := migrateCmd.String("move-log", "", "Write the move log here (default out-base-dir/migrate-DATE-TIME.jsonl)")
+	migrateUndo := migrateCmd.String("undo", "", "Reverse the moves of this move log")
+	migrateLogFlags := addLogFlags(migrateCmd)
+
+	playlistsCmd := flag.NewFlagSet("playlists", flag.ExitOnError)
+	destDirPlaylistsPtr := playlistsCmd.String("out-base-dir", "./music", "Location of your shows")
+	playlistsFlags := addPlaylistFlags(playlistsCmd)
+	playlistsLogFlags := addLogFlags(playlistsCmd)
+
+	scheduleCmd := flag.NewFlagSet("schedule", flag.ExitOnError)
+	scheduleStation := scheduleCmd.String("station", "fm4", "The station whose program guide is shown")
+	scheduleDate := scheduleCmd.String("date", "", "The broadcast day to show (YYYYMMDD, default today)")
+	scheduleWeek := scheduleCmd.Bool("week", false, "Show the week starting at -date instead of a single day")
+	scheduleProgramKey := scheduleCmd.String("program-key", "", "Only broadcasts of this programKey (e.g. 4DD)")
+	scheduleTitle := scheduleCmd.String("title", "", "Only broadcasts whose title contains this text")
+	scheduleWeekday := scheduleCmd.String("weekday", "", "Only broadcasts on these weekdays (e.g. sat,sun)")
+	scheduleMinDuration := scheduleCmd.Duration("min-duration", 0, "Only broadcasts lasting at least this long (e.g. 90m)")
+	scheduleOnDemand := scheduleCmd.Bool("on-demand", false, "Only broadcasts available on demand")
+	scheduleFormat := scheduleCmd.String("format", "table", "Output format: text, table, json or csv")
+	scheduleLogFlags := addLogFlags(scheduleCmd)
+	scheduleCacheFlags := addCacheFlags(scheduleCmd)
+
+	inspectCmd := flag.NewFlagSet("inspect", flag.ExitOnError)
+	inspectFormat := inspectCmd.String("format", "text", "Output format: text or json")
+	inspectLogFlags := addLogFlags(inspectCmd)
+	inspectCacheFlags := addCacheFlags(inspectCmd)
 
 	if len(os.Args) < 2 {
-		fmt.Println("expected 'download', 'url' or 'search' subcommands")
+		fmt.Println("expected 'download', 'url', 'record', 'subscribe', 'list', 'verify', 'migrate', 'playlists', 'schedule', 'inspect', 'clip', 'search' or 'find-song' subcommands")
 		os.Exit(1)
 	}
 
@@ -47,37 +144,206 @@ func main() {
 
 	case "download":
 		_ = downloadCmd.Parse(os.Args[2:])
-		log.Println("subcommand 'download'")
-		log.Println("  show:", *showPtr)
-		log.Println("  out-base-dir:", *destDirPtr)
-		log.Println("  tail:", downloadCmd.Args())
-		Download(*showPtr, *destDirPtr)
+		downloadLogFlags.setup()
+		downloadCacheFlags.setup(*downloadFlags.dryRun)
+		slog.Info("subcommand 'download'",
+			"show", *showPtr,
+			"out-base-dir", *destDirPtr,
+			"tail", downloadCmd.Args())
+		opts := downloadFlags.options()
+		opts.selection = downloadSelection.selection()
+		if opts.selection.onlyThisEpisode {
+			fatal("-only-this-episode needs a Sendung URL, use the 'url' subcommand")
+		}
+		configureThrottle(opts)
+		serveMetricsIfRequested(opts)
+		repeatIfRequested(opts, func() { Download(*showPtr, *destDirPtr, opts) })
 	case "url":
 		_ = urlCmd.Parse(os.Args[2:])
+		urlLogFlags.setup()
+		urlCacheFlags.setup(*urlDownloadFlags.dryRun)
 		if len(urlCmd.Args()) < 1 {
-			log.Fatal("subcommand 'url' expects a sound.orf.at Sendung URL " +
+			fatal("subcommand 'url' expects a sound.orf.at Sendung URL " +
 				"(https://sound.orf.at/radio/fm4/sendung/42628/davidecks) " +
 				"or a programKey (e.g. 4DD)")
 		}
 		showRef := urlCmd.Arg(0)
-		log.Println("subcommand 'url'")
-		log.Println("  show:", showRef)
-		log.Println("  out-base-dir:", *destDirUrlPtr)
-		DownloadByUrl(showRef, *destDirUrlPtr)
+		slog.Info("subcommand 'url'",
+			"show", showRef,
+			"out-base-dir", *destDirUrlPtr)
+		opts := urlDownloadFlags.options()
+		opts.selection = urlSelection.selection()
+		configureThrottle(opts)
+		serveMetricsIfRequested(opts)
+		repeatIfRequested(opts, func() { DownloadByUrl(showRef, *destDirUrlPtr, opts) })
+	case "record":
+		_ = recordCmd.Parse(os.Args[2:])
+		recordLogFlags.setup()
+		recordCacheFlags.setup(*recordDownloadFlags.dryRun)
+		if len(recordCmd.Args()) < 1 {
+			fatal("subcommand 'record' expects a sound.orf.at Sendung URL, " +
+				"a programKey (e.g. 4DD) or a show name")
+		}
+		// A recording is neither cut nor deduplicated, and waits for the
+		// broadcast instead of a download window.
+		rejectFlags(recordCmd, "expiry-warn", "download-window", "refine-cuts", "jingles",
+			"repeats", "repeat-audio", "playlists", "playlist-paths", "playlist-latest")
+		showRef := recordCmd.Arg(0)
+		opts := recordDownloadFlags.options()
+		configureThrottle(opts)
+		serveMetricsIfRequested(opts)
+		repeatIfRequested(opts, func() {
+			Record(showRef, *destDirRecordPtr, recordOptions{
+				liveUrl:  *recordLiveUrl,
+				preRoll:  *recordPreRoll,
+				postRoll: *recordPostRoll,
+				days:     *recordDays,
+				download: opts,
+			})
+		})
+	case "subscribe":
+		_ = subscribeCmd.Parse(os.Args[2:])
+		subscribeLogFlags.setup()
+		subscribeCacheFlags.setup(*subscribeDownloadFlags.dryRun)
+		if *subscribeRules == "" {
+			fatal("subcommand 'subscribe' expects a -rules file")
+		}
+		rules, err := loadRules(*subscribeRules)
+		logError(err)
+		opts := subscribeDownloadFlags.options()
+		configureThrottle(opts)
+		serveMetricsIfRequested(opts)
+		repeatIfRequested(opts, func() {
+			Subscribe(*destDirSubscribePtr, subscribeOptions{rules: rules, days: *subscribeDays, download: opts})
+		})
+	case "list":
+		_ = listCmd.Parse(os.Args[2:])
+		listLogFlags.setup()
+		listCacheFlags.setup(false)
+		if len(listCmd.Args()) < 1 {
+			fatal("subcommand 'list' expects a sound.orf.at Sendung URL, " +
+				"a programKey (e.g. 4DD) or a show name")
+		}
+		List(listCmd.Arg(0), *destDirListPtr, *listFormat)
+	case "verify":
+		_ = verifyCmd.Parse(os.Args[2:])
+		verifyLogFlags.setup()
+		verifyCacheFlags.setup(*verifyDownloadFlags.dryRun)
+		opts := verifyDownloadFlags.options()
+		configureThrottle(opts)
+		Verify(*destDirVerifyPtr, verifyOptions{
+			format:     *verifyFormat,
+			redownload: *verifyRedownload,
+			download:   opts,
+		})
+	case "migrate":
+		_ = migrateCmd.Parse(os.Args[2:])
+		migrateLogFlags.setup()
+		Migrate(*destDirMigratePtr, migrateOptions{
+			dryRun:  *migrateDryRun,
+			moveLog: *migrateMoveLog,
+			undo:    *migrateUndo,
+		})
+	case "playlists":
+		_ = playlistsCmd.Parse(os.Args[2:])
+		playlistsLogFlags.setup()
+		WritePlaylists(*destDirPlaylistsPtr, playlistsFlags.options())
+	case "schedule":
+		_ = scheduleCmd.Parse(os.Args[2:])
+		scheduleLogFlags.setup()
+		scheduleCacheFlags.setup(false)
+		weekdays, err := parseWeekdays(*scheduleWeekday)
+		logError(err)
+		days := 1
+		if *scheduleWeek {
+			days = 7
+		}
+		Schedule(scheduleOptions{
+			station: *scheduleStation,
+			day:     scheduleDay(*scheduleDate),
+			days:    days,
+			filter: broadcastFilter{
+				ProgramKey:   *scheduleProgramKey,
+				Title:        *scheduleTitle,
+				Weekdays:     weekdays,
+				MinDuration:  *scheduleMinDuration,
+				OnDemandOnly: *scheduleOnDemand,
+			},
+			format: *scheduleFormat,
+		})
+	case "inspect":
+		_ = inspectCmd.Parse(os.Args[2:])
+		inspectLogFlags.setup()
+		inspectCacheFlags.setup(false)
+		if len(inspectCmd.Args()) < 1 {
+			fatal("subcommand 'inspect' expects a sound.orf.at Sendung URL " +
+				"(https://sound.orf.at/radio/fm4/sendung/42628/davidecks) or a broadcast id (e.g. 42628)")
+		}
+		Inspect(inspectCmd.Arg(0), *inspectFormat)
+	case "clip":
+		_ = clipCmd.Parse(os.Args[2:])
+		clipLogFlags.setup()
+		clipCacheFlags.setup(false)
+		if len(clipCmd.Args()) < 1 {
+			fatal("subcommand 'clip' expects a sound.orf.at Sendung URL " +
+				"(https://sound.orf.at/radio/fm4/sendung/42628/davidecks) or a broadcast id (e.g. 42628)")
+		}
+		Clip(clipCmd.Arg(0), clipOptions{
+			start:  *clipStart,
+			end:    *clipEnd,
+			title:  *clipTitle,
+			outDir: *clipOutDir,
+		})
 	case "search":
 		_ = searchCmd.Parse(os.Args[2:])
-		SearchBroadcastUrls(*searchQuery)
+		searchLogFlags.setup()
+		searchCacheFlags.setup(*searchDownloadFlags.dryRun)
+		searchDownload := searchDownloadFlags.options()
+		configureThrottle(searchDownload)
+		Search(*searchQuery, searchOptions{
+			filter:      searchFilter.filter(),
+			format:      *searchFormat,
+			sortBy:      *searchSort,
+			reverse:     *searchReverse,
+			limit:       *searchLimit,
+			interactive: *searchInteractive,
+			destDir:     *searchDestDir,
+			download:    searchDownload,
+		})
+	case "find-song":
+		_ = findSongCmd.Parse(os.Args[2:])
+		findSongLogFlags.setup()
+		findSongCacheFlags.setup(false)
+		if *findSongQuery == "" {
+			fatal("subcommand 'find-song' expects a -query with the artist and/or title")
+		}
+		FindSong(*findSongQuery, findSongOptions{
+			format:      *findSongFormat,
+			download:    *findSongDownload,
+			interactive: *findSongInteractive,
+			outDir:      *findSongOutDir,
+		})
 	default:
-		log.Println("expected 'download', 'url' or 'search' subcommands")
+		slog.Error("expected 'download', 'url', 'record', 'subscribe', 'list', 'verify', 'migrate', 'playlists', 'schedule', 'inspect', 'clip', 'search' or 'find-song' subcommands")
 		os.Exit(1)
 	}
 }
 
-func Download(showSearch string, destDir string) {
+// Download searches for a show by name, resolves the matching program's stable
+// programKey and downloads every episode still in the 30-day on-demand window,
+// just like DownloadByUrl does for a programKey.
+func Download(showSearch string, destDir string, opts downloadOptions) {
 
-	broadcastUrls := SearchBroadcastUrls(showSearch)
+	programKey := ResolveProgramKey(showSearch)
+	if programKey == "" {
+		return
+	}
 
-	downloadBroadcasts(broadcastUrls, destDir)
+	slog.Info("Resolved show from search", "programKey", programKey, "query", showSearch)
+	broadcastUrls := getProgramEpisodes(programKey, opts.selection)
+
+	downloadBroadcasts(broadcastUrls, destDir, opts)
+	markSuccessfulRun(showSearch)
 }
 
 // DownloadByUrl downloads all available episodes of the show referenced by
@@ -86,44 +352,168 @@ func Download(showSearch string, destDir string) {
 // programKey (e.g. "4DD"). Every episode still in the 30-day on-demand window
 // is fetched. Prefer the programKey for recurring downloads: a URL's episode
 // id ages out of the window after 30 days, a programKey does not.
-func DownloadByUrl(showRef string, destDir string) {
+func DownloadByUrl(showRef string, destDir string, opts downloadOptions) {
 
-	broadcastUrls := ResolveBroadcastUrls(showRef)
+	broadcastUrls := ResolveBroadcastUrls(showRef, opts.selection)
 
-	downloadBroadcasts(broadcastUrls, destDir)
+	downloadBroadcasts(broadcastUrls, destDir, opts)
+	markSuccessfulRun(showRef)
 }
 
-func downloadBroadcasts(broadcastUrls []string, destDir string) {
+// downloadBroadcasts archives the given episodes below destDir. All episodes
+// are fetched up front so the ones closest to leaving the on-demand window are
+// downloaded first, and unarchived episodes about to expire are warned about
+// before the (possibly long) run starts.
+func downloadBroadcasts(broadcastUrls []string, destDir string, opts downloadOptions) {
 
+	var broadcasts []Broadcast
 	for _, broadcastUrl := range broadcastUrls {
+		broadcasts = append(broadcasts, getBroadcast(broadcastUrl))
+	}
+	sortByExpiry(broadcasts)
+	warnExpiring(broadcasts, destDir, opts)
 
-		broadcast := getBroadcast(broadcastUrl)
+	var repeats *repeatIndex
+	if opts.repeats != "" && opts.repeats != repeatKeep {
+		repeats = newRepeatIndex()
+	}
+	if opts.dryRun {
+		printDryRun(os.Stdout, broadcasts, destDir, opts, repeats)
+		return
+	}
+
+	stages := postProcessing(opts)
+	report := newRunReport(opts.report)
+	finish := func() {
+		report.write()
+		observeReport(report)
+		observeArchiveSize(report)
+		notifyReport(opts.notify, report)
+	}
+	defer func(hooks []func()) { exitHooks = hooks }(exitHooks)
+	exitHooks = append(exitHooks, finish)
+
+	for _, broadcast := range broadcasts {
 
 		show := createShow(broadcast)
+		entry := report.add(broadcast)
 
 		if len(show.Streams) > 0 {
 			outDir := getOutputPath(destDir, show)
 			fileName := getFileName(show)
+			entry.Path = getFilePath(destDir, show)
+
+			existing, err := fileExists(entry.Path)
+			logError(err)
+			started := time.Now()
+
+			ep := &processedEpisode{
+				broadcast: broadcast,
+				show:      show,
+				destDir:   destDir,
+				path:      entry.Path,
+				existing:  existing,
+				report:    entry,
+			}
+			if repeats != nil && checkRepeat(ep, repeats, opts) {
+				slog.Info("Processed episode",
+					"title", entry.Title,
+					"broadcastDay", entry.BroadcastDay,
+					"outcome", entry.Outcome,
+					"path", entry.Path)
+				continue
+			}
 
-			var mp3Path string
-			if segs := contentSegments(show); len(segs) > 0 {
-				urls := make([]string, len(segs))
-				for i, seg := range segs {
-					urls[i] = getSegmentUrl(show, seg)
+			var segs []segment
+			if !existing && jingleCut(show, opts) {
+				ep.path, segs = downloadJingleCut(show, opts, outDir, fileName)
+			} else {
+				segs = contentSegments(show)
+				if !existing {
+					segs = refineSegments(show, segs, opts.refineCuts)
+				}
+				if len(segs) > 0 {
+					urls := make([]string, len(segs))
+					for i, seg := range segs {
+						urls[i] = getSegmentUrl(show, seg)
+					}
+					ep.path = DownloadFileSegments(urls, outDir, fileName)
+				} else {
+					ep.path = DownloadFile(getDownloadUrl(show), outDir, fileName)
+				}
+			}
+			if len(segs) > 0 {
+				entry.Segments = segmentReports(segs)
+				for _, seg := range segs {
+					entry.Duration += seg.offsetEnd - seg.offset
 				}
-				mp3Path = DownloadFileSegments(urls, outDir, fileName)
 			} else {
-				mp3Path = DownloadFile(getDownloadUrl(show), outDir, fileName)
+				entry.Duration = show.Streams[0].End - show.Streams[0].Start
+			}
+
+			entry.Outcome = outcomeExists
+			if !existing {
+				entry.Outcome = outcomeDownloaded
+				entry.DownloadTime = time.Since(started).Milliseconds()
+				if info, err := os.Stat(ep.path); err == nil {
+					entry.Bytes = info.Size()
+				}
 			}
 
-			imagePath := saveImage(destDir, show)
-			writeId3Tag(mp3Path, imagePath, show)
+			if postProcess(ep, stages, opts) && repeats != nil {
+				repeats.add(ep.path, broadcast.BroadcastDay, contentItems(broadcast.Items))
+			}
+			slog.Info("Processed episode",
+				"title", entry.Title,
+				"broadcastDay", entry.BroadcastDay,
+				"outcome", entry.Outcome,
+				"bytes", entry.Bytes,
+				"path", entry.Path)
 		} else {
-			log.Println("No streams found. Skipped download.")
+			entry.Outcome = outcomeNoStreams
+			slog.Warn("No streams found. Skipped download.", "title", show.Title, "broadcastDay", show.BroadcastDay)
 		}
 	}
 
-	log.Println("Done.")
+	if opts.playlists != nil {
+		if err := writePlaylists(destDir, *opts.playlists); err != nil {
+			slog.Error("Could not write the playlists", "error", err)
+		}
+	}
+
+	finish()
+	slog.Info("Done.")
+}
+
+// jingleCut reports whether a new episode is cut by the jingles: its item
+// metadata is missing or incomplete and a -jingles library is loaded. Complete
+// metadata may just have nothing to cut.
+func jingleCut(show Show, opts downloadOptions) bool {
+	return !opts.jingles.empty() && itemsIncomplete(show)
+}
+
+// postProcess runs the pipeline over a written episode, marks the episode
+// failed if a stage fails and announces newly archived ones. Returns whether
+// the pipeline succeeded.
+func postProcess(ep *processedEpisode, stages pipeline, opts downloadOptions) bool {
+	entry := ep.report
+	if err := stages.run(ep); err != nil {
+		entry.Outcome = outcomeFailed
+		entry.Error = err.Error()
+		slog.Error("Post-processing failed", "title", entry.Title, "path", entry.Path, "error", err)
+		return false
+	}
+	if !ep.existing {
+		opts.notify.notify(event{
+			Event:        eventArchived,
+			Title:        entry.Title,
+			ProgramKey:   entry.ProgramKey,
+			BroadcastDay: entry.BroadcastDay,
+			Path:         entry.Path,
+			Cover:        entry.Cover,
+		})
+	}
+	return true
 }
 
 func createShow(broadcast Broadcast) Show {
@@ -158,7 +548,7 @@ func getBroadcast(broadcastUrl string) Broadcast {
 	logError(err)
 
 	broadcast := wrapper.Payload.toBroadcast()
-	log.Printf("Found broadcast info of show %s, broadcasted on %s", broadcast.Title, broadcast.StartISO)
+	slog.Info("Found broadcast info", "title", broadcast.Title, "start", broadcast.StartISO)
 	return broadcast
 }
 
@@ -194,16 +584,24 @@ func sanitize(value string) string {
 }
 
 func saveImage(path string, show Show) string {
-	var imageUrl string
-	if show.Images != nil && len(show.Images) > 0 {
+	if imageUrl := getCoverUrl(show); imageUrl != "" {
+		return DownloadFile(imageUrl, getOutputPath(path, show), "cover.jpg")
+	}
+	if len(show.Images) == 0 {
+		slog.Info("No Cover images returned.", "title", show.Title)
+	}
+	return ""
+}
+
+// getCoverUrl returns the url of the 434px wide version of the show's first
+// image, or "" if there is none.
+func getCoverUrl(show Show) string {
+	if len(show.Images) > 0 {
 		for _, v := range show.Images[0].Versions {
 			if v.Width == 434 {
-				imageUrl = v.Path
-				return DownloadFile(imageUrl, getOutputPath(path, show), "cover.jpg")
+				return v.Path
 			}
 		}
-	} else {
-		log.Println("No Cover images returned.")
 	}
 	return ""
 }
@@ -225,6 +623,11 @@ func getOutputPath(destDir string, show Show) string {
 		show.Year)
 }
 
+// getFilePath is where downloadBroadcasts stores the show's mp3.
+func getFilePath(destDir string, show Show) string {
+	return getOutputPath(destDir, show) + "/" + getFileName(show)
+}
+
 func getDownloadUrl(show Show) string {
 	// Canonical sound.orf.at stream URL for the loopStreamId, read from the
 	// v5.0 payload's urls/uriTemplates (cleaned of the RFC-6570 token suffix
@@ -242,7 +645,7 @@ func getSegmentUrl(show Show, seg segment) string {
 
 func logError(err error) {
 	if err != nil {
-		log.Fatal(err)
+		fatal(err.Error())
 	}
 }
 
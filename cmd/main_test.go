@@ -12,6 +12,11 @@ import (
 )
 import "github.com/jarcoal/httpmock"
 
+func TestMain(m *testing.M) {
+	setupHttpClient()
+	os.Exit(m.Run())
+}
+
 func TestGetBroadcast(t *testing.T) {
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
@@ -194,3 +199,26 @@ func copyFile(src string, dst string) {
 		log.Fatal(err)
 	}
 }
+
+func TestDownloadResolvesProgramKey(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/current/search?q=Swound+Sound",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/searchresult.json"))
+		},
+	)
+	programUrl := "https://audioapi.orf.at/fm4/api/json/5.0/broadcasts/program/4SS"
+	httpmock.RegisterResponder("GET", programUrl,
+		httpmock.NewStringResponder(200, `{"timezoneOffset":-7200000,"payload":[]}`),
+	)
+
+	// The name is resolved to the programKey and the full episode list is
+	// fetched instead of downloading only the search hits.
+	Download("Swound Sound", t.TempDir(), downloadOptions{})
+
+	if got := httpmock.GetCallCountInfo()["GET "+programUrl]; got != 1 {
+		t.Errorf("broadcasts/program/4SS called %d times, want 1", got)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metricsRegistry holds the archiver's own metrics, served on -metrics-addr.
+var metricsRegistry = prometheus.NewRegistry()
+
+var (
+	episodesDiscovered = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "archiver_episodes_discovered_total",
+		Help: "Episodes found in the on-demand window, per show (programKey).",
+	}, []string{"show"})
+	episodesDownloaded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "archiver_episodes_downloaded_total",
+		Help: "Episodes downloaded and tagged, per show (programKey).",
+	}, []string{"show"})
+	episodesFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "archiver_episodes_failed_total",
+		Help: "Episodes whose download was aborted by an error, per show (programKey).",
+	}, []string{"show"})
+	bytesDownloaded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "archiver_downloaded_bytes_total",
+		Help: "Bytes of audio downloaded, per show (programKey).",
+	}, []string{"show"})
+	downloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "archiver_episode_download_duration_seconds",
+		Help:    "Time spent downloading an episode, per show (programKey).",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+	}, []string{"show"})
+	apiRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "archiver_http_request_duration_seconds",
+		Help:    "Latency of outgoing HTTP requests until the response headers arrived.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"endpoint", "code"})
+	lastSuccessfulRun = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "archiver_last_successful_run_timestamp_seconds",
+		Help: "Unix time of the last run that completed without error, per subscription (show reference).",
+	}, []string{"subscription"})
+	archiveSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "archiver_archive_size_bytes",
+		Help: "Size of the archived files of a show (programKey) after the last run.",
+	}, []string{"show"})
+)
+
+func init() {
+	metricsRegistry.MustRegister(
+		episodesDiscovered, episodesDownloaded, episodesFailed, bytesDownloaded,
+		downloadDuration, apiRequestDuration, lastSuccessfulRun, archiveSize,
+	)
+}
+
+// metricsTransport measures requests and delegates to http.DefaultTransport,
+// looked up per request so test doubles installed later are honoured.
+type metricsTransport struct{}
+
+func (metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := http.DefaultTransport.RoundTrip(req)
+
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	apiRequestDuration.WithLabelValues(endpointName(req), code).Observe(time.Since(started).Seconds())
+	return resp, err
+}
+
+// endpointName groups request urls into the endpoints the archiver talks to.
+func endpointName(req *http.Request) string {
+	switch {
+	case strings.HasPrefix(req.URL.Host, "loopstream"):
+		return "loopstream"
+	case strings.Contains(req.URL.Path, "/broadcasts/program/"):
+		return "broadcasts/program"
+	case strings.Contains(req.URL.Path, "/broadcast/"):
+		return "broadcast"
+	case strings.HasSuffix(req.URL.Path, "/search"):
+		return "search"
+	case req.URL.Host == "radiobilder.orf.at":
+		return "image"
+	default:
+		return "other"
+	}
+}
+
+// serveMetrics serves /metrics on addr in the background.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(metricsRegistry, promhttp.HandlerOpts{}))
+	go func() {
+		slog.Info("Serving metrics", "addr", addr)
+		// Not fatal: under runOnce it panics, and a panic on this goroutine
+		// cannot be recovered. A daemon without its metrics is misconfigured,
+		// so exit right away.
+		if err := http.ListenAndServe(addr, mux); err != nil {
+			slog.Error("Metrics server failed", "addr", addr, "error", err)
+			os.Exit(1)
+		}
+	}()
+}
+
+// observeReport records the episodes of a (possibly aborted) run.
+func observeReport(report *runReport) {
+	for _, episode := range report.Episodes {
+		show := episode.ProgramKey
+		episodesDiscovered.WithLabelValues(show).Inc()
+		switch episode.Outcome {
+		case outcomeDownloaded:
+			episodesDownloaded.WithLabelValues(show).Inc()
+			bytesDownloaded.WithLabelValues(show).Add(float64(episode.Bytes))
+			downloadDuration.WithLabelValues(show).Observe(float64(episode.DownloadTime) / 1000)
+		case outcomeFailed:
+			episodesFailed.WithLabelValues(show).Inc()
+		}
+	}
+}
+
+// observeArchiveSize records the size of every show directory touched by the
+// run (the parent of getOutputPath's year directory).
+func observeArchiveSize(report *runReport) {
+	dirs := map[string]string{}
+	for _, episode := range report.Episodes {
+		if episode.Path != "" {
+			dirs[episode.ProgramKey] = filepath.Dir(filepath.Dir(episode.Path))
+		}
+	}
+	for show, dir := range dirs {
+		var size int64
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && !d.IsDir() {
+				if info, err := d.Info(); err == nil {
+					size += info.Size()
+				}
+			}
+			return nil
+		})
+		archiveSize.WithLabelValues(show).Set(float64(size))
+	}
+}
+
+// markSuccessfulRun records that the run for a subscription completed.
+func markSuccessfulRun(subscription string) {
+	lastSuccessfulRun.WithLabelValues(subscription).SetToCurrentTime()
+}
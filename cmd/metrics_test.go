@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestEndpointName(t *testing.T) {
+	cases := map[string]string{
+		"https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628?items=1000":     "broadcast",
+		"https://audioapi.orf.at/fm4/api/json/5.0/broadcasts/program/4DD":         "broadcasts/program",
+		"https://audioapi.orf.at/fm4/api/json/current/search?q=Davidecks":         "search",
+		"https://loopstreamfm4.apa.at?channel=fm4&id=x.mp3&offset=0&offsetende=1": "loopstream",
+		"https://radiobilder.orf.at/fm4/imgprog/width434/keep/4DD.jpg":            "image",
+		"https://example.org/": "other",
+	}
+	for raw, want := range cases {
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := endpointName(&http.Request{URL: u}); got != want {
+			t.Errorf("%s: got %q want %q", raw, got, want)
+		}
+	}
+}
+
+func TestDownloadMetrics(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	broadcastUrl := registerDavidecksDownload()
+
+	downloaded := testutil.ToFloat64(episodesDownloaded.WithLabelValues("4DD"))
+	discovered := testutil.ToFloat64(episodesDiscovered.WithLabelValues("4DD"))
+
+	destDir := t.TempDir()
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{})
+
+	if got := testutil.ToFloat64(episodesDownloaded.WithLabelValues("4DD")) - downloaded; got != 1 {
+		t.Errorf("downloaded episodes increased by %v, want 1", got)
+	}
+	if got := testutil.ToFloat64(episodesDiscovered.WithLabelValues("4DD")) - discovered; got != 1 {
+		t.Errorf("discovered episodes increased by %v, want 1", got)
+	}
+	if testutil.ToFloat64(archiveSize.WithLabelValues("4DD")) == 0 {
+		t.Error("expected the archive size of 4DD to be recorded")
+	}
+	if testutil.CollectAndCount(apiRequestDuration) == 0 {
+		t.Error("expected the API requests to be measured")
+	}
+}
+
+func TestRunOnceSurvivesFatal(t *testing.T) {
+	if ok := runOnce(func() { fatal("boom") }); ok {
+		t.Error("runOnce reported success for an aborted run")
+	}
+	if ok := runOnce(func() {}); !ok {
+		t.Error("runOnce reported failure for a completed run")
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/bogem/id3v2"
+)
+
+// Operations of the move log.
+const (
+	opMove = "move"
+	opLink = "link" // a cover shared by episodes staying behind
+)
+
+var broadcastDayPattern = regexp.MustCompile(`^\d{8}$`)
+
+// move is an entry of the move log. The log is JSON lines, written as the
+// moves happen, so even an interrupted migration can be undone.
+type move struct {
+	Op   string `json:"op"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type migrateOptions struct {
+	dryRun  bool
+	moveLog string
+	undo    string
+}
+
+// Migrate moves the episodes below destDir whose path differs from the one
+// the current naming rules give them, along with their sidecars and covers.
+func Migrate(destDir string, opts migrateOptions) {
+	if opts.undo != "" {
+		logError(undoMigration(opts.undo, destDir))
+		return
+	}
+
+	moves := planMigration(destDir)
+	if opts.dryRun {
+		for _, m := range moves {
+			_, _ = fmt.Fprintf(os.Stdout, "%s %s -> %s\n", m.Op, m.From, m.To)
+		}
+		return
+	}
+	if len(moves) == 0 {
+		slog.Info("Archive already follows the current layout", "out-base-dir", destDir)
+		return
+	}
+
+	if opts.moveLog == "" {
+		opts.moveLog = filepath.Join(destDir, "migrate-"+now().Format("20060102-150405")+".jsonl")
+	}
+	logError(applyMigration(moves, opts.moveLog, destDir))
+	slog.Info("Migrated archive", "moves", len(moves), "log", opts.moveLog)
+}
+
+// archivedShow recovers the show of an archived episode, as far as the
+// naming rules need it, from its sidecar or else its tags.
+func archivedShow(path string) (Show, bool) {
+	var metadata episodeMetadata
+	if data, err := os.ReadFile(sidecarPath(path)); err == nil && json.Unmarshal(data, &metadata) == nil && metadata.Title != "" {
+		return Show{
+			Title:          metadata.Title,
+			TitleSanitized: sanitize(metadata.Title),
+			BroadcastDay:   strconv.Itoa(metadata.BroadcastDay),
+			Year:           strconv.Itoa(metadata.Start.Year()),
+		}, true
+	}
+
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return Show{}, false
+	}
+	defer tag.Close()
+	// writeId3Tag sets the artist to the show title and the title to
+	// "Title - YYYYMMDD".
+	title, year := trim(tag.Artist()), trim(tag.Year())
+	day := strconv.Itoa(broadcastDayOf(path))
+	if i := strings.LastIndex(tag.Title(), " - "); i >= 0 && broadcastDayPattern.MatchString(tag.Title()[i+3:]) {
+		day = tag.Title()[i+3:]
+	}
+	if title == "" || year == "" || day == "0" {
+		return Show{}, false
+	}
+	return Show{
+		Title:          title,
+		TitleSanitized: sanitize(title),
+		BroadcastDay:   day,
+		Year:           year,
+	}, true
+}
+
+// planMigration returns the moves that bring the archive to the current
+// layout.
+func planMigration(destDir string) []move {
+	var episodes []string
+	err := filepath.WalkDir(destDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, ".mp3") {
+			episodes = append(episodes, path)
+		}
+		return err
+	})
+	logError(err)
+
+	var moves []move
+	targets := map[string]bool{}
+	remaining := map[string]int{} // episodes in a directory
+	for _, path := range episodes {
+		remaining[filepath.Dir(path)]++
+	}
+
+	type episodeMove struct{ from, to string }
+	var planned []episodeMove
+	for _, path := range episodes {
+		show, ok := archivedShow(path)
+		if !ok {
+			slog.Warn("Cannot tell the show of this file, leaving it", "path", path)
+			continue
+		}
+		target := getFilePath(destDir, show)
+		if filepath.Clean(target) == filepath.Clean(path) {
+			continue
+		}
+		exists, err := fileExists(target)
+		logError(err)
+		if exists || targets[target] {
+			slog.Warn("Target exists already, leaving the file", "path", path, "target", target)
+			continue
+		}
+		targets[target] = true
+		planned = append(planned, episodeMove{path, target})
+	}
+
+	for _, p := range planned {
+		moves = append(moves, move{opMove, p.from, p.to})
+		if sidecar := sidecarPath(p.from); fileExistsOrFalse(sidecar) {
+			moves = append(moves, move{opMove, sidecar, sidecarPath(p.to)})
+		}
+		remaining[filepath.Dir(p.from)]--
+	}
+
+	// A cover is linked into every new directory lacking one, and moved into
+	// the last of them if no episode stays behind.
+	var fromDirs []string
+	coverDirs := map[string][]string{}
+	covered := map[string]bool{}
+	for _, p := range planned {
+		fromDir, toDir := filepath.Dir(p.from), filepath.Dir(p.to)
+		if covered[toDir] || !fileExistsOrFalse(filepath.Join(fromDir, "cover.jpg")) ||
+			fileExistsOrFalse(filepath.Join(toDir, "cover.jpg")) {
+			continue
+		}
+		covered[toDir] = true
+		if coverDirs[fromDir] == nil {
+			fromDirs = append(fromDirs, fromDir)
+		}
+		coverDirs[fromDir] = append(coverDirs[fromDir], toDir)
+	}
+	for _, fromDir := range fromDirs {
+		toDirs := coverDirs[fromDir]
+		for i, toDir := range toDirs {
+			op := opLink
+			if i == len(toDirs)-1 && remaining[fromDir] == 0 {
+				op = opMove
+			}
+			moves = append(moves, move{op, filepath.Join(fromDir, "cover.jpg"), filepath.Join(toDir, "cover.jpg")})
+		}
+	}
+	return moves
+}
+
+func fileExistsOrFalse(path string) bool {
+	exists, _ := fileExists(path)
+	return exists
+}
+
+// applyMigration performs the moves, logging each one before going on to the
+// next, and removes the directories left empty.
+func applyMigration(moves []move, moveLog string, destDir string) error {
+	logFile, err := os.OpenFile(moveLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	enc := json.NewEncoder(logFile)
+
+	emptied := map[string]bool{}
+	for _, m := range moves {
+		if err := makeDirectoryIfNotExisting(filepath.Dir(m.To)); err != nil {
+			return err
+		}
+		switch m.Op {
+		case opMove:
+			err = os.Rename(m.From, m.To)
+			emptied[filepath.Dir(m.From)] = true
+		case opLink:
+			err = linkOrCopy(m.From, m.To)
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s: %w", m.Op, m.From, err)
+		}
+		slog.Info("Moved", "op", m.Op, "from", m.From, "to", m.To)
+		if err := enc.Encode(m); err != nil {
+			return err
+		}
+		if err := logFile.Sync(); err != nil {
+			return err
+		}
+	}
+	for dir := range emptied {
+		removeEmptyDirs(dir, destDir)
+	}
+	return nil
+}
+
+// undoMigration reverses the moves of a move log, last one first.
+func undoMigration(moveLog string, destDir string) error {
+	file, err := os.Open(moveLog)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var moves []move
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var m move
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return fmt.Errorf("%s: %w", moveLog, err)
+		}
+		moves = append(moves, m)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for i := len(moves) - 1; i >= 0; i-- {
+		m := moves[i]
+		if err := makeDirectoryIfNotExisting(filepath.Dir(m.From)); err != nil {
+			return err
+		}
+		switch m.Op {
+		case opMove:
+			err = os.Rename(m.To, m.From)
+		case opLink:
+			err = os.Remove(m.To)
+		}
+		if err != nil && !(m.Op == opLink && errors.Is(err, os.ErrNotExist)) {
+			return fmt.Errorf("undo %s %s: %w", m.Op, m.To, err)
+		}
+		removeEmptyDirs(filepath.Dir(m.To), destDir)
+	}
+	slog.Info("Undid migration", "moves", len(moves), "log", moveLog)
+	return nil
+}
+
+// linkOrCopy hardlinks from to to, copying where links are not possible.
+func linkOrCopy(from, to string) error {
+	if os.Link(from, to) == nil {
+		return nil
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(to)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// removeEmptyDirs removes dir and its parents up to (not including) root as
+// long as they are empty.
+func removeEmptyDirs(dir, root string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
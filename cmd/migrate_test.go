@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/bogem/id3v2"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestMigrate(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	broadcastUrl := registerDavidecksDownload()
+
+	destDir := t.TempDir()
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{sidecar: true})
+
+	// An older layout without the year directory, with a second episode that
+	// has tags but no sidecar.
+	newDir := path.Join(destDir, "Davidecks", "2026")
+	oldDir := path.Join(destDir, "Davidecks")
+	for _, name := range []string{"Davidecks_20260620.mp3", "Davidecks_20260620.json", "cover.jpg"} {
+		if err := os.Rename(path.Join(newDir, name), path.Join(oldDir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Remove(newDir); err != nil {
+		t.Fatal(err)
+	}
+	older := path.Join(oldDir, "Davidecks_20260613.mp3")
+	data, err := os.ReadFile(path.Join(oldDir, "Davidecks_20260620.mp3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(older, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := id3v2.Open(older, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.SetTitle("Davidecks - 20260613")
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	_ = tag.Close()
+
+	moveLog := path.Join(t.TempDir(), "moves.jsonl")
+	Migrate(destDir, migrateOptions{moveLog: moveLog})
+
+	for _, name := range []string{"Davidecks_20260620.mp3", "Davidecks_20260620.json", "Davidecks_20260613.mp3", "cover.jpg"} {
+		if _, err := os.Stat(path.Join(newDir, name)); err != nil {
+			t.Errorf("expected %s in the new layout: %v", name, err)
+		}
+		if _, err := os.Stat(path.Join(oldDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to have left the old layout: %v", name, err)
+		}
+	}
+	if moves := planMigration(destDir); len(moves) != 0 {
+		t.Errorf("expected nothing left to migrate, got %+v", moves)
+	}
+
+	Migrate(destDir, migrateOptions{undo: moveLog})
+	for _, name := range []string{"Davidecks_20260620.mp3", "Davidecks_20260620.json", "Davidecks_20260613.mp3", "cover.jpg"} {
+		if _, err := os.Stat(path.Join(oldDir, name)); err != nil {
+			t.Errorf("expected %s to be back: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(newDir); !os.IsNotExist(err) {
+		t.Errorf("expected the new directory to be removed again: %v", err)
+	}
+}
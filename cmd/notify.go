@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Event types sent to the notification sinks.
+const (
+	eventArchived  = "archived"
+	eventFailed    = "failed"
+	eventExpiring  = "expiring"
+	eventCompleted = "completed"
+)
+
+// notifyClient sends the notifications. Unlike the default client it neither
+// waits for the request delay nor goes through the response cache, so the
+// sinks are still reached in offline mode.
+var notifyClient = &http.Client{Timeout: time.Minute}
+
+// event is a notification fired by downloadBroadcasts. Sinks that take JSON
+// get it verbatim; the others render subject and message from it.
+type event struct {
+	Event        string    `json:"event"`
+	Title        string    `json:"title,omitempty"`
+	ProgramKey   string    `json:"programKey,omitempty"`
+	BroadcastDay int       `json:"broadcastDay,omitempty"`
+	Path         string    `json:"path,omitempty"`
+	Cover        string    `json:"cover,omitempty"`
+	Expiry       time.Time `json:"expiry,omitzero"`
+	Error        string    `json:"error,omitempty"`
+	// Counts of a completed run.
+	Episodes   int `json:"episodes,omitempty"`
+	Downloaded int `json:"downloaded,omitempty"`
+	Failed     int `json:"failed,omitempty"`
+}
+
+func (e event) subject() string {
+	switch e.Event {
+	case eventArchived:
+		return fmt.Sprintf("Archived %s - %d", e.Title, e.BroadcastDay)
+	case eventFailed:
+		return fmt.Sprintf("Failed to archive %s - %d", e.Title, e.BroadcastDay)
+	case eventExpiring:
+		return fmt.Sprintf("%s - %d expires soon", e.Title, e.BroadcastDay)
+	default:
+		return fmt.Sprintf("Archiver run completed: %d downloaded, %d failed", e.Downloaded, e.Failed)
+	}
+}
+
+func (e event) message() string {
+	var lines []string
+	if e.Path != "" {
+		lines = append(lines, "Path: "+e.Path)
+	}
+	if e.Cover != "" {
+		lines = append(lines, "Cover: "+e.Cover)
+	}
+	if !e.Expiry.IsZero() {
+		lines = append(lines, "Expires: "+e.Expiry.Local().Format(YYYYMMDD+" "+HHMMSS24h))
+	}
+	if e.Error != "" {
+		lines = append(lines, "Error: "+e.Error)
+	}
+	if e.Event == eventCompleted {
+		lines = append(lines, fmt.Sprintf("Episodes: %d, downloaded: %d, failed: %d", e.Episodes, e.Downloaded, e.Failed))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sink delivers events somewhere.
+type sink interface {
+	send(e event) error
+}
+
+// notifier fans events out to all configured sinks. A failing sink is logged
+// and never stops the archiving.
+type notifier []sink
+
+func (n notifier) notify(e event) {
+	for _, s := range n {
+		if err := s.send(e); err != nil {
+			slog.Warn("Notification failed", "event", e.Event, "sink", fmt.Sprintf("%T", s), "error", err)
+		}
+	}
+}
+
+// notifyReport sends the failed events of an (aborted) run and the completed
+// event summarising it.
+func notifyReport(n notifier, report *runReport) {
+	completed := event{Event: eventCompleted, Episodes: len(report.Episodes)}
+	for _, episode := range report.Episodes {
+		switch episode.Outcome {
+		case outcomeDownloaded:
+			completed.Downloaded++
+		case outcomeFailed:
+			completed.Failed++
+			message := episode.Error
+			if message == "" {
+				message = fatalMessage
+			}
+			n.notify(event{
+				Event:        eventFailed,
+				Title:        episode.Title,
+				ProgramKey:   episode.ProgramKey,
+				BroadcastDay: episode.BroadcastDay,
+				Path:         episode.Path,
+				Error:        message,
+			})
+		}
+	}
+	n.notify(completed)
+}
+
+// webhookSink POSTs the event as JSON.
+type webhookSink struct {
+	url string
+}
+
+func (s webhookSink) send(e event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return post(s.url, "application/json", body, nil)
+}
+
+// ntfySink publishes to an ntfy topic url (e.g. https://ntfy.sh/my-archive).
+type ntfySink struct {
+	url string
+}
+
+func (s ntfySink) send(e event) error {
+	if e.Event == eventCompleted {
+		// A push per run would drown the per-episode pushes.
+		return nil
+	}
+	headers := map[string]string{"Title": e.subject(), "Tags": e.Event}
+	if e.Event == eventFailed || e.Event == eventExpiring {
+		headers["Priority"] = "high"
+	}
+	return post(s.url, "text/plain", []byte(e.message()), headers)
+}
+
+// gotifySink publishes to a Gotify server's /message endpoint.
+type gotifySink struct {
+	url   string
+	token string
+}
+
+func (s gotifySink) send(e event) error {
+	if e.Event == eventCompleted {
+		return nil
+	}
+	priority := 5
+	if e.Event == eventFailed || e.Event == eventExpiring {
+		priority = 8
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"title":    e.subject(),
+		"message":  e.message(),
+		"priority": priority,
+	})
+	if err != nil {
+		return err
+	}
+	return post(strings.TrimSuffix(s.url, "/")+"/message", "application/json", body,
+		map[string]string{"X-Gotify-Key": s.token})
+}
+
+// smtpSink mails every event.
+type smtpSink struct {
+	addr     string // host:port
+	from     string
+	to       []string
+	username string
+	password string
+}
+
+func (s smtpSink) send(e event) error {
+	var auth smtp.Auth
+	if s.username != "" {
+		host, _, _ := strings.Cut(s.addr, ":")
+		auth = smtp.PlainAuth("", s.username, s.password, host)
+	}
+	// Titles are free text: line breaks would start new headers, and anything
+	// beyond ASCII needs an encoded-word.
+	subject := strings.NewReplacer("\r", " ", "\n", " ").Replace(e.subject())
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		s.from, strings.Join(s.to, ", "), mime.QEncoding.Encode("utf-8", subject), strings.ReplaceAll(e.message(), "\n", "\r\n"))
+	return smtp.SendMail(s.addr, auth, s.from, s.to, []byte(msg))
+}
+
+// healthcheckSink pings a healthchecks.io-style url when a run completes, or
+// its /fail url when episodes failed.
+type healthcheckSink struct {
+	url string
+}
+
+func (s healthcheckSink) send(e event) error {
+	if e.Event != eventCompleted {
+		return nil
+	}
+	url := s.url
+	if e.Failed > 0 {
+		url = strings.TrimSuffix(url, "/") + "/fail"
+	}
+	response, err := notifyClient.Get(url)
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("GET %s returned %s", url, response.Status)
+	}
+	return nil
+}
+
+func post(url string, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	response, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = response.Body.Close()
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("POST %s returned %s", url, response.Status)
+	}
+	return nil
+}
+
+// notifyFlags registers the notification sink flags. The SMTP password is
+// read from the SMTP_PASSWORD environment variable to keep it out of ps.
+type notifyFlags struct {
+	webhook     *string
+	ntfy        *string
+	gotify      *string
+	gotifyToken *string
+	smtpAddr    *string
+	smtpFrom    *string
+	smtpTo      *string
+	smtpUser    *string
+	healthcheck *string
+}
+
+func addNotifyFlags(fs *flag.FlagSet) *notifyFlags {
+	return &notifyFlags{
+		webhook:     fs.String("notify-webhook", "", "POST every event as JSON to this URL"),
+		ntfy:        fs.String("notify-ntfy", "", "Push episode events to this ntfy topic URL"),
+		gotify:      fs.String("notify-gotify", "", "Push episode events to this Gotify server URL"),
+		gotifyToken: fs.String("notify-gotify-token", "", "Gotify application token"),
+		smtpAddr:    fs.String("notify-smtp", "", "Mail every event via this SMTP server (host:port)"),
+		smtpFrom:    fs.String("notify-smtp-from", "", "Sender address of the mails"),
+		smtpTo:      fs.String("notify-smtp-to", "", "Comma separated recipients of the mails"),
+		smtpUser:    fs.String("notify-smtp-user", "", "SMTP user name (password from $SMTP_PASSWORD)"),
+		healthcheck: fs.String("healthcheck-url", "", "Ping this URL after every run (URL/fail if episodes failed)"),
+	}
+}
+
+func (f *notifyFlags) notifier() notifier {
+	var n notifier
+	if *f.webhook != "" {
+		n = append(n, webhookSink{url: *f.webhook})
+	}
+	if *f.ntfy != "" {
+		n = append(n, ntfySink{url: *f.ntfy})
+	}
+	if *f.gotify != "" {
+		n = append(n, gotifySink{url: *f.gotify, token: *f.gotifyToken})
+	}
+	if *f.smtpAddr != "" {
+		var to []string
+		for _, addr := range strings.Split(*f.smtpTo, ",") {
+			if addr = trim(addr); addr != "" {
+				to = append(to, addr)
+			}
+		}
+		if *f.smtpFrom == "" || len(to) == 0 {
+			fatal("-notify-smtp needs -notify-smtp-from and -notify-smtp-to")
+		}
+		n = append(n, smtpSink{
+			addr:     *f.smtpAddr,
+			from:     *f.smtpFrom,
+			to:       to,
+			username: *f.smtpUser,
+			password: os.Getenv("SMTP_PASSWORD"),
+		})
+	}
+	if *f.healthcheck != "" {
+		n = append(n, healthcheckSink{url: *f.healthcheck})
+	}
+	return n
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var archivedEvent = event{
+	Event:        eventArchived,
+	Title:        "Davidecks",
+	ProgramKey:   "4DD",
+	BroadcastDay: 20260620,
+	Path:         "music/Davidecks/2026/Davidecks_20260620.mp3",
+	Cover:        "music/Davidecks/2026/cover.jpg",
+}
+
+// recordingServer is a local HTTP stand-in that records the requests it gets.
+func recordingServer(t *testing.T) (*httptest.Server, *[]*http.Request, *[]string) {
+	t.Helper()
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests, &bodies
+}
+
+func TestWebhookSink(t *testing.T) {
+	server, requests, bodies := recordingServer(t)
+
+	if err := (webhookSink{url: server.URL}).send(archivedEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	var got event
+	if err := json.Unmarshal([]byte((*bodies)[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != archivedEvent || (*requests)[0].Header.Get("Content-Type") != "application/json" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestNtfySink(t *testing.T) {
+	server, requests, bodies := recordingServer(t)
+	sink := ntfySink{url: server.URL + "/archive"}
+
+	if err := sink.send(archivedEvent); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.send(event{Event: eventCompleted}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(*requests) != 1 {
+		t.Fatalf("got %d pushes, want 1 (completed runs are not pushed)", len(*requests))
+	}
+	req := (*requests)[0]
+	if req.URL.Path != "/archive" || req.Header.Get("Title") != "Archived Davidecks - 20260620" {
+		t.Errorf("got %s with title %q", req.URL.Path, req.Header.Get("Title"))
+	}
+	if !strings.Contains((*bodies)[0], "Cover: music/Davidecks/2026/cover.jpg") {
+		t.Errorf("body got %q", (*bodies)[0])
+	}
+}
+
+func TestGotifySink(t *testing.T) {
+	server, requests, bodies := recordingServer(t)
+
+	if err := (gotifySink{url: server.URL, token: "secret"}).send(event{Event: eventFailed, Title: "Davidecks", BroadcastDay: 20260620, Error: "boom"}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := (*requests)[0]
+	if req.URL.Path != "/message" || req.Header.Get("X-Gotify-Key") != "secret" {
+		t.Errorf("got %s with key %q", req.URL.Path, req.Header.Get("X-Gotify-Key"))
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal([]byte((*bodies)[0]), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["priority"] != float64(8) || !strings.Contains(got["message"].(string), "Error: boom") {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestHealthcheckSink(t *testing.T) {
+	server, requests, _ := recordingServer(t)
+	sink := healthcheckSink{url: server.URL + "/ping/uuid"}
+
+	for _, e := range []event{archivedEvent, {Event: eventCompleted, Downloaded: 1}, {Event: eventCompleted, Failed: 1}} {
+		if err := sink.send(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(*requests) != 2 || (*requests)[0].URL.Path != "/ping/uuid" || (*requests)[1].URL.Path != "/ping/uuid/fail" {
+		var paths []string
+		for _, r := range *requests {
+			paths = append(paths, r.URL.Path)
+		}
+		t.Errorf("got pings %v, want [/ping/uuid /ping/uuid/fail]", paths)
+	}
+}
+
+// fakeSMTP is a minimal local SMTP stand-in accepting a single mail.
+func fakeSMTP(t *testing.T) (string, chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	mails := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		inData := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			if inData {
+				if line == ".\r\n" {
+					inData = false
+					mails <- data.String()
+					reply("250 OK")
+					continue
+				}
+				data.WriteString(line)
+				continue
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case cmd == "DATA":
+				inData = true
+				reply("354 go ahead")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	return listener.Addr().String(), mails
+}
+
+func TestSmtpSink(t *testing.T) {
+	addr, mails := fakeSMTP(t)
+
+	sink := smtpSink{addr: addr, from: "archiver@example.org", to: []string{"me@example.org"}}
+	if err := sink.send(archivedEvent); err != nil {
+		t.Fatal(err)
+	}
+
+	mail := <-mails
+	if !strings.Contains(mail, "Subject: Archived Davidecks - 20260620") || !strings.Contains(mail, "Path: music/Davidecks/2026/Davidecks_20260620.mp3") {
+		t.Errorf("mail got %q", mail)
+	}
+}
+
+func TestSmtpSubject(t *testing.T) {
+	addr, mails := fakeSMTP(t)
+
+	sink := smtpSink{addr: addr, from: "archiver@example.org", to: []string{"me@example.org"}}
+	injected := archivedEvent
+	injected.Title = "Ö1 Klassik\r\nBcc: everyone@example.org"
+	if err := sink.send(injected); err != nil {
+		t.Fatal(err)
+	}
+	mail := <-mails
+	if strings.Contains(mail, "\nBcc:") {
+		t.Errorf("the title injected a header: %q", mail)
+	}
+	_, header, _ := strings.Cut(mail, "Subject: ")
+	header, _, _ = strings.Cut(header, "\r\n")
+	if subject, err := new(mime.WordDecoder).DecodeHeader(header); err != nil || subject != "Archived Ö1 Klassik  Bcc: everyone@example.org - 20260620" {
+		t.Errorf("subject got %q, %v", subject, err)
+	}
+}
+
+func TestNotifyReport(t *testing.T) {
+	var got []event
+	n := notifier{sinkFunc(func(e event) error { got = append(got, e); return nil })}
+
+	report := &runReport{Episodes: []*episodeReport{
+		{Title: "Davidecks", BroadcastDay: 20260620, Outcome: outcomeDownloaded},
+		{Title: "Davidecks", BroadcastDay: 20260613, Outcome: outcomeFailed},
+	}}
+	notifyReport(n, report)
+
+	if len(got) != 2 || got[0].Event != eventFailed || got[0].BroadcastDay != 20260613 {
+		t.Fatalf("got %+v, want a failed and a completed event", got)
+	}
+	if got[1].Event != eventCompleted || got[1].Episodes != 2 || got[1].Downloaded != 1 || got[1].Failed != 1 {
+		t.Errorf("completed got %+v", got[1])
+	}
+}
+
+type sinkFunc func(e event) error
+
+func (f sinkFunc) send(e event) error { return f(e) }
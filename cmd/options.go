@@ -0,0 +1,159 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"time"
+)
+
+// downloadOptions tune how downloadBroadcasts processes the episodes of a run.
+// The zero value downloads everything with the default behaviour.
+type downloadOptions struct {
+	// expiryWarn is the horizon within which an episode that is not archived
+	// yet triggers an expiry warning. 0 disables the warnings.
+	expiryWarn time.Duration
+	// notify receives the archived, failed, expiring and completed events.
+	notify notifier
+	// dryRun prints what would be downloaded instead of downloading it.
+	dryRun bool
+	// report, if set, is the path the JSON run report is written to.
+	report string
+	// metricsAddr, if set, is where /metrics is served during the run(s).
+	metricsAddr string
+	// every, if set, repeats the run at this interval instead of exiting.
+	every time.Duration
+	// maxRate caps the download bandwidth in bytes per second; 0 is unlimited.
+	maxRate int64
+	// windows restrict downloads to these times of day.
+	windows []timeWindow
+	// requestDelay is the minimum time between two requests to ORF.
+	requestDelay time.Duration
+	// hooks are the external post-processing stages run after tagging.
+	hooks []stage
+	// sidecar writes the episode metadata as JSON next to every mp3.
+	sidecar bool
+	// refineCuts, if set, snaps every cut to the quietest point within this
+	// tolerance.
+	refineCuts time.Duration
+	// jingles are matched against broadcasts with missing or incomplete item
+	// metadata to cut.
+	jingles jingleLibrary
+	// repeats is what to do with repeats of archived episodes.
+	repeats string
+	// repeatAudio confirms repeats found by their metadata by their audio.
+	repeatAudio bool
+	// replayGain measures the loudness of new episodes and tags it.
+	replayGain bool
+	// playlists, if set, regenerates the playlists after every run.
+	playlists *playlistOptions
+	// selection picks the episodes of a program to download.
+	selection episodeSelection
+}
+
+// downloadFlags registers the downloadOptions command line flags shared by the
+// subcommands that download episodes.
+type downloadFlags struct {
+	expiryWarn   *time.Duration
+	notify       *notifyFlags
+	dryRun       *bool
+	report       *string
+	metricsAddr  *string
+	every        *time.Duration
+	maxRate      *string
+	windows      *string
+	requestDelay *time.Duration
+	refineCuts   *time.Duration
+	jingles      *string
+	repeats      *string
+	repeatAudio  *bool
+	hooks        *hookFlags
+	playlists    *bool
+	playlist     *playlistFlags
+}
+
+func addDownloadFlags(fs *flag.FlagSet) *downloadFlags {
+	return &downloadFlags{
+		expiryWarn:   fs.Duration("expiry-warn", 48*time.Hour, "Warn about unarchived episodes expiring within this time (0 disables)"),
+		notify:       addNotifyFlags(fs),
+		dryRun:       fs.Bool("dry-run", false, "Print paths, cut segments, tags and expected sizes without downloading episodes or writing anything, the cache included; -refine-cuts and -repeat-audio still read short audio windows"),
+		report:       fs.String("report", "", "Write a JSON report of the run to this file"),
+		metricsAddr:  fs.String("metrics-addr", "", "Serve Prometheus metrics on this address (e.g. :9090)"),
+		every:        fs.Duration("every", 0, "Keep running and repeat the download at this interval (e.g. 6h)"),
+		maxRate:      fs.String("max-rate", "", "Cap the download bandwidth (e.g. 2MB/s)"),
+		windows:      fs.String("download-window", "", "Only download within these times of day (e.g. 01:00-07:00,22:00-23:30)"),
+		requestDelay: fs.Duration("api-delay", 0, "Minimum delay between two requests to ORF (e.g. 500ms)"),
+		refineCuts:   fs.Duration("refine-cuts", 0, "Snap cuts to the quietest point within this tolerance (e.g. 2s)"),
+		jingles:      fs.String("jingles", "", "Directory of reference clips to cut by when the item metadata of a broadcast is missing or incomplete"),
+		repeats:      fs.String("repeats", repeatKeep, "What to do with repeats of archived episodes: keep, tag, skip or hardlink"),
+		repeatAudio:  fs.Bool("repeat-audio", false, "Confirm repeats found by their metadata by comparing the audio"),
+		hooks:        addHookFlags(fs),
+		playlists:    fs.Bool("playlists", false, "Regenerate the M3U8 playlists of the archive after every run"),
+		playlist:     addPlaylistFlags(fs),
+	}
+}
+
+func (f *downloadFlags) options() downloadOptions {
+	maxRate, err := parseRate(*f.maxRate)
+	logError(err)
+	windows, err := parseWindows(*f.windows)
+	logError(err)
+	switch *f.repeats {
+	case repeatKeep, repeatTag, repeatSkip, repeatLink:
+	default:
+		fatal("unknown repeat policy, expected keep, tag, skip or hardlink", "repeats", *f.repeats)
+	}
+	var playlists *playlistOptions
+	if *f.playlists {
+		opts := f.playlist.options()
+		playlists = &opts
+	}
+	var jingles jingleLibrary
+	if *f.jingles != "" {
+		jingles, err = loadJingles(*f.jingles)
+		logError(err)
+	}
+	return downloadOptions{
+		expiryWarn:   *f.expiryWarn,
+		notify:       f.notify.notifier(),
+		dryRun:       *f.dryRun,
+		report:       *f.report,
+		metricsAddr:  *f.metricsAddr,
+		every:        *f.every,
+		maxRate:      maxRate,
+		windows:      windows,
+		requestDelay: *f.requestDelay,
+		refineCuts:   *f.refineCuts,
+		jingles:      jingles,
+		repeats:      *f.repeats,
+		repeatAudio:  *f.repeatAudio,
+		hooks:        f.hooks.stages(),
+		sidecar:      *f.hooks.sidecar,
+		replayGain:   *f.hooks.replay,
+		playlists:    playlists,
+	}
+}
+
+// rejectFlags fails if one of the named flags was set, for the shared flags a
+// subcommand registers but has no use for.
+func rejectFlags(fs *flag.FlagSet, names ...string) {
+	fs.Visit(func(f *flag.Flag) {
+		if slices.Contains(names, f.Name) {
+			fatalf("-%s has no effect on '%s'", f.Name, fs.Name())
+		}
+	})
+}
+
+func serveMetricsIfRequested(opts downloadOptions) {
+	if opts.metricsAddr != "" {
+		serveMetrics(opts.metricsAddr)
+	}
+}
+
+// repeatIfRequested calls run once, or every opts.every in long-running mode.
+func repeatIfRequested(opts downloadOptions, run func()) {
+	if opts.every > 0 {
+		runEvery(opts.every, run)
+		return
+	}
+	run()
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bogem/id3v2"
+)
+
+// latestPlaylist is the playlist of the newest episodes of all shows.
+const latestPlaylist = "latest.m3u8"
+
+// playlistOptions tune the M3U8 playlists written next to the archive.
+type playlistOptions struct {
+	// absolute writes absolute paths instead of ones relative to the playlist.
+	absolute bool
+	// latest is the number of episodes in latest.m3u8.
+	latest int
+}
+
+type playlistFlags struct {
+	paths  *string
+	latest *int
+}
+
+func addPlaylistFlags(fs *flag.FlagSet) *playlistFlags {
+	return &playlistFlags{
+		paths:  fs.String("playlist-paths", "relative", "Paths in the playlists: relative or absolute"),
+		latest: fs.Int("playlist-latest", 50, "Number of episodes in the playlist of the latest episodes"),
+	}
+}
+
+func (f *playlistFlags) options() playlistOptions {
+	switch *f.paths {
+	case "relative", "absolute":
+	default:
+		fatal("unknown playlist paths, expected relative or absolute", "playlist-paths", *f.paths)
+	}
+	if *f.latest < 0 {
+		fatal("-playlist-latest must not be negative", "playlist-latest", *f.latest)
+	}
+	return playlistOptions{absolute: *f.paths == "absolute", latest: *f.latest}
+}
+
+// playlistEntry is an archived episode as listed in a playlist.
+type playlistEntry struct {
+	path         string
+	title        string
+	seconds      int64
+	broadcastDay int
+}
+
+// WritePlaylists writes the playlists of the archive below destDir: one per
+// show directory, one per show and year, and latest.m3u8 with the newest
+// episodes of all shows.
+func WritePlaylists(destDir string, opts playlistOptions) {
+	logError(writePlaylists(destDir, opts))
+}
+
+func writePlaylists(destDir string, opts playlistOptions) error {
+	shows := map[string][]playlistEntry{}
+	years := map[string][]playlistEntry{}
+	var all []playlistEntry
+	err := filepath.WalkDir(destDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".mp3") {
+			return err
+		}
+		// Only episodes in the show/year layout of getOutputPath.
+		rel, err := filepath.Rel(destDir, path)
+		if err != nil || len(strings.Split(rel, string(filepath.Separator))) != 3 {
+			return err
+		}
+		entry := readPlaylistEntry(path)
+		yearDir := filepath.Dir(path)
+		showDir := filepath.Dir(yearDir)
+		shows[showDir] = append(shows[showDir], entry)
+		years[yearDir] = append(years[yearDir], entry)
+		all = append(all, entry)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for showDir, entries := range shows {
+		sortEntries(entries)
+		if err := writePlaylist(filepath.Join(showDir, filepath.Base(showDir)+".m3u8"), entries, opts); err != nil {
+			return err
+		}
+	}
+	for yearDir, entries := range years {
+		sortEntries(entries)
+		name := filepath.Base(filepath.Dir(yearDir)) + "_" + filepath.Base(yearDir) + ".m3u8"
+		if err := writePlaylist(filepath.Join(yearDir, name), entries, opts); err != nil {
+			return err
+		}
+	}
+
+	sortEntries(all)
+	latest := make([]playlistEntry, 0, opts.latest)
+	for i := len(all) - 1; i >= 0 && len(latest) < opts.latest; i-- {
+		latest = append(latest, all[i])
+	}
+	if err := writePlaylist(filepath.Join(destDir, latestPlaylist), latest, opts); err != nil {
+		return err
+	}
+	slog.Info("Wrote playlists", "shows", len(shows), "years", len(years), "episodes", len(all))
+	return nil
+}
+
+// sortEntries orders the entries by broadcast day.
+func sortEntries(entries []playlistEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].broadcastDay != entries[j].broadcastDay {
+			return entries[i].broadcastDay < entries[j].broadcastDay
+		}
+		return entries[i].path < entries[j].path
+	})
+}
+
+// writePlaylist writes an extended M3U8 playlist of the entries in their
+// order, replacing the old one only once the new one is complete.
+func writePlaylist(path string, entries []playlistEntry, opts playlistOptions) error {
+	partPath := path + ".part"
+	file, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(file)
+	_, _ = fmt.Fprintln(w, "#EXTM3U")
+	for _, entry := range entries {
+		location := entry.path
+		if !opts.absolute {
+			location, err = filepath.Rel(filepath.Dir(path), entry.path)
+		} else {
+			location, err = filepath.Abs(entry.path)
+		}
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+		_, _ = fmt.Fprintf(w, "#EXTINF:%d,%s\n%s\n", entry.seconds, entry.title, filepath.ToSlash(location))
+	}
+	if err := w.Flush(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(partPath, path)
+}
+
+// readPlaylistEntry takes the title and length of an episode from its tags.
+// Without a TLEN frame the length is estimated from the file size and the
+// bitrate of the first frame; ORF streams have a constant bitrate.
+func readPlaylistEntry(path string) playlistEntry {
+	entry := playlistEntry{
+		path:         path,
+		title:        strings.TrimSuffix(filepath.Base(path), ".mp3"),
+		seconds:      -1,
+		broadcastDay: broadcastDayOf(path),
+	}
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true, ParseFrames: []string{"Title", "TLEN"}})
+	if err != nil {
+		slog.Warn("Could not read tags for the playlist", "path", path, "error", err)
+		return entry
+	}
+	defer tag.Close()
+	if title := trim(tag.Title()); title != "" {
+		entry.title = title
+	}
+	if ms, err := strconv.ParseInt(tag.GetTextFrame("TLEN").Text, 10, 64); err == nil {
+		entry.seconds = ms / 1000
+	} else if seconds, err := estimateLength(path); err == nil {
+		entry.seconds = seconds
+	}
+	return entry
+}
+
+func estimateLength(path string) (int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	header := make([]byte, 10)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return 0, err
+	}
+	start := id3v2Size(header)
+	if _, err := file.ReadAt(header[:4], start); err != nil {
+		return 0, err
+	}
+	_, bitrate := frameHeader(header[:4])
+	if bitrate == 0 {
+		return 0, fmt.Errorf("no mp3 frame at offset %d", start)
+	}
+	return (info.Size() - start) * 8 / int64(bitrate), nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func readPlaylist(t *testing.T, file string) []string {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Split(strings.TrimSpace(string(data)), "\n")
+}
+
+func TestPlaylists(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	urls := []string{registerDavidecksDownload(), registerRepeat()}
+
+	destDir := t.TempDir()
+	downloadBroadcasts(urls, destDir, downloadOptions{playlists: &playlistOptions{latest: 1}})
+
+	show := readPlaylist(t, path.Join(destDir, "Davidecks", "Davidecks.m3u8"))
+	want := []string{
+		"#EXTM3U",
+		"#EXTINF:40,Davidecks - 20260620",
+		"2026/Davidecks_20260620.mp3",
+		"#EXTINF:40,Davidecks - 20260627",
+		"2026/Davidecks_20260627.mp3",
+	}
+	if strings.Join(show, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(show, "\n"), strings.Join(want, "\n"))
+	}
+
+	year := readPlaylist(t, path.Join(destDir, "Davidecks", "2026", "Davidecks_2026.m3u8"))
+	if len(year) != 5 || year[2] != "Davidecks_20260620.mp3" {
+		t.Errorf("unexpected year playlist %q", year)
+	}
+
+	latest := readPlaylist(t, path.Join(destDir, latestPlaylist))
+	if len(latest) != 3 || latest[2] != "Davidecks/2026/Davidecks_20260627.mp3" {
+		t.Errorf("expected just the newest episode, got %q", latest)
+	}
+
+	if err := writePlaylists(destDir, playlistOptions{absolute: true, latest: 50}); err != nil {
+		t.Fatal(err)
+	}
+	latest = readPlaylist(t, path.Join(destDir, latestPlaylist))
+	if len(latest) != 5 || !regexp.MustCompile(`^/.*/Davidecks/2026/Davidecks_20260627\.mp3$`).MatchString(latest[2]) {
+		t.Errorf("expected absolute paths, newest first, got %q", latest)
+	}
+}
+
+func TestPlaylistFlags(t *testing.T) {
+	tests := []struct {
+		args []string
+		ok   bool
+	}{
+		{nil, true},
+		{[]string{"-playlist-latest", "0", "-playlist-paths", "absolute"}, true},
+		{[]string{"-playlist-latest", "-1"}, false},
+		{[]string{"-playlist-paths", "home"}, false},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("playlists", flag.ContinueOnError)
+		f := addPlaylistFlags(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		if ok := runOnce(func() { f.options() }); ok != tt.ok {
+			t.Errorf("%v: got ok %v want %v", tt.args, ok, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// processedEpisode is what the post-processing stages work on: a broadcast
+// whose mp3 has just been written to path.
+type processedEpisode struct {
+	broadcast Broadcast
+	show      Show
+	destDir   string
+	path      string
+	// cover is the path of the saved cover image, set by coverStage.
+	cover string
+	// existing is set if the mp3 was archived by an earlier run.
+	existing bool
+	// retagged is set when a stage rewrote the tags of an existing mp3.
+	retagged bool
+	// repeatOf is the path of the original if the episode is a repeat.
+	repeatOf string
+	report   *episodeReport
+}
+
+// stage is a post-processing step. Stages run in order after the download;
+// an error marks the episode failed and skips the remaining stages.
+type stage interface {
+	name() string
+	run(ep *processedEpisode) error
+}
+
+// pipeline is the ordered list of stages of a run.
+type pipeline []stage
+
+// postProcessing returns the stages configured by opts: cover and tags always,
+// repeat tags, ReplayGain and the sidecar if requested, then the external hooks.
+func postProcessing(opts downloadOptions) pipeline {
+	p := pipeline{coverStage{}, tagStage{}}
+	if opts.repeats == repeatTag {
+		p = append(p, repeatStage{})
+	}
+	if opts.replayGain {
+		p = append(p, loudnessStage{})
+	}
+	if opts.sidecar {
+		p = append(p, sidecarStage{})
+	}
+	for _, hook := range opts.hooks {
+		p = append(p, hook)
+	}
+	return p
+}
+
+func (p pipeline) run(ep *processedEpisode) error {
+	for _, s := range p {
+		slog.Debug("Running post-processing stage", "stage", s.name(), "path", ep.path)
+		if err := s.run(ep); err != nil {
+			return fmt.Errorf("%s: %w", s.name(), err)
+		}
+	}
+	return nil
+}
+
+// coverStage saves the cover image next to the episode.
+type coverStage struct{}
+
+func (coverStage) name() string { return "cover" }
+
+func (coverStage) run(ep *processedEpisode) error {
+	ep.cover = saveImage(ep.destDir, ep.show)
+	ep.report.Cover = ep.cover
+	return nil
+}
+
+// tagStage writes the ID3 tags and attaches the cover.
+type tagStage struct{}
+
+func (tagStage) name() string { return "tags" }
+
+func (tagStage) run(ep *processedEpisode) error {
+	if ep.existing && id3TagUpToDate(ep.path, ep.cover, ep.show) {
+		return nil
+	}
+	writeId3Tag(ep.path, ep.cover, ep.show)
+	ep.retagged = ep.existing
+	return nil
+}
+
+// episodeMetadata describes an archived episode to sidecar files and hooks.
+type episodeMetadata struct {
+	Path         string          `json:"path"`
+	Cover        string          `json:"cover,omitempty"`
+	Title        string          `json:"title"`
+	Subtitle     string          `json:"subtitle,omitempty"`
+	Station      string          `json:"station"`
+	ProgramKey   string          `json:"programKey"`
+	BroadcastDay int             `json:"broadcastDay"`
+	Href         string          `json:"href"`
+	Start        time.Time       `json:"start"`
+	End          time.Time       `json:"end"`
+	Duration     int64           `json:"duration"` // milliseconds of audio kept
+	Segments     []segmentReport `json:"segments,omitempty"`
+	Loudness     *loudness       `json:"loudness,omitempty"`
+	Tags         id3Values       `json:"tags"`
+	// Size and SHA256 of the mp3 as written, for the verify subcommand. Only
+	// sidecar files record them.
+	Size   int64  `json:"size,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+}
+
+func (ep *processedEpisode) metadata() episodeMetadata {
+	return episodeMetadata{
+		Path:         ep.path,
+		Cover:        ep.cover,
+		Title:        ep.show.Title,
+		Subtitle:     ep.show.Description,
+		Station:      ep.broadcast.Station,
+		ProgramKey:   ep.broadcast.ProgramKey,
+		BroadcastDay: ep.broadcast.BroadcastDay,
+		Href:         ep.broadcast.Href,
+		Start:        ep.broadcast.StartISO,
+		End:          ep.broadcast.EndISO,
+		Duration:     ep.report.Duration,
+		Segments:     ep.report.Segments,
+		Loudness:     ep.report.Loudness,
+		Tags:         getId3Values(ep.show),
+	}
+}
+
+// sidecarStage writes the episode metadata as JSON next to the mp3.
+type sidecarStage struct{}
+
+func (sidecarStage) name() string { return "sidecar" }
+
+func (sidecarStage) run(ep *processedEpisode) error {
+	metadata := ep.metadata()
+	var err error
+	if ep.existing && !ep.retagged {
+		// The checksum is of the file as last written. Computing it again
+		// would record any later corruption as good and hide it from verify.
+		metadata.Size, metadata.SHA256 = recordedChecksum(ep.path)
+	} else if metadata.Size, metadata.SHA256, err = checksum(ep.path); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sidecarPath(ep.path), data, 0644)
+}
+
+// recordedChecksum returns the size and checksum recorded in the sidecar of
+// an archived episode, or zero values if there is none.
+func recordedChecksum(mp3Path string) (int64, string) {
+	var recorded episodeMetadata
+	data, err := os.ReadFile(sidecarPath(mp3Path))
+	if err != nil || json.Unmarshal(data, &recorded) != nil {
+		return 0, ""
+	}
+	return recorded.Size, recorded.SHA256
+}
+
+// checksum returns the size and hex SHA-256 of a file.
+func checksum(path string) (int64, string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	return size, hex.EncodeToString(hash.Sum(nil)), err
+}
+
+func sidecarPath(mp3Path string) string {
+	return strings.TrimSuffix(mp3Path, ".mp3") + ".json"
+}
+
+// Failure policies of the external hooks.
+const (
+	hookIgnore = "ignore"
+	hookFail   = "fail"
+	hookRetry  = "retry"
+)
+
+// hookRetryDelay is the pause between two attempts of a retried hook.
+var hookRetryDelay = 10 * time.Second
+
+// commandStage runs an external command for every newly archived episode. The
+// command is run by sh with the mp3 path as $1, the metadata as ARCHIVER_*
+// environment variables and as JSON on stdin.
+type commandStage struct {
+	command string
+	timeout time.Duration
+	policy  string
+	retries int
+}
+
+func (s commandStage) name() string { return "hook " + strconv.Quote(s.command) }
+
+func (s commandStage) run(ep *processedEpisode) error {
+	if ep.existing {
+		// Hooks act on new files only; re-running them for the whole archive
+		// on every run would re-sync or re-transcode everything.
+		return nil
+	}
+
+	attempts := 1
+	if s.policy == hookRetry {
+		attempts += s.retries
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			slog.Warn("Hook failed, retrying", "hook", s.command, "attempt", attempt, "error", err)
+			sleep(hookRetryDelay)
+		}
+		if err = s.exec(ep); err == nil {
+			return nil
+		}
+	}
+	if s.policy == hookIgnore {
+		slog.Warn("Hook failed, ignoring", "hook", s.command, "path", ep.path, "error", err)
+		return nil
+	}
+	unarchive(ep)
+	return err
+}
+
+// unarchive moves a new episode whose hook failed back to its .part file and
+// removes its sidecar, so the next run downloads it again and reruns the hooks
+// instead of taking it for archived.
+func unarchive(ep *processedEpisode) {
+	slog.Warn("Keeping the episode as .part for the next run to retry", "path", ep.path)
+	if err := os.Rename(ep.path, ep.path+".part"); err != nil {
+		slog.Error("Could not move the episode out of the archive", "path", ep.path, "error", err)
+		return
+	}
+	if err := os.Remove(sidecarPath(ep.path)); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Could not remove the sidecar", "path", sidecarPath(ep.path), "error", err)
+	}
+}
+
+func (s commandStage) exec(ep *processedEpisode) error {
+	meta := ep.metadata()
+	input, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.command, "sh", ep.path)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = append(os.Environ(),
+		"ARCHIVER_PATH="+meta.Path,
+		"ARCHIVER_COVER="+meta.Cover,
+		"ARCHIVER_TITLE="+meta.Title,
+		"ARCHIVER_STATION="+meta.Station,
+		"ARCHIVER_PROGRAM_KEY="+meta.ProgramKey,
+		"ARCHIVER_BROADCAST_DAY="+strconv.Itoa(meta.BroadcastDay),
+		"ARCHIVER_HREF="+meta.Href,
+		"ARCHIVER_DURATION="+strconv.FormatInt(meta.Duration, 10),
+	)
+	// Don't wait forever for children that inherited the output pipe.
+	cmd.WaitDelay = time.Second
+
+	output, err := cmd.CombinedOutput()
+	slog.Debug("Hook finished", "hook", s.command, "output", string(output))
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", s.timeout)
+	}
+	if err != nil {
+		if out := trim(string(output)); out != "" {
+			return fmt.Errorf("%w: %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
+
+// hookList collects the repeatable -post-hook flag.
+type hookList []string
+
+func (h *hookList) String() string { return strings.Join(*h, "; ") }
+
+func (h *hookList) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+// hookFlags registers the post-processing flags.
+type hookFlags struct {
+	commands hookList
+	timeout  *time.Duration
+	policy   *string
+	retries  *int
+	sidecar  *bool
+	replay   *bool
+}
+
+func addHookFlags(fs *flag.FlagSet) *hookFlags {
+	f := &hookFlags{
+		timeout: fs.Duration("hook-timeout", 10*time.Minute, "Kill a post-download hook after this time"),
+		policy:  fs.String("hook-failure", hookFail, "When a hook fails: ignore, fail (mark the episode failed) or retry"),
+		retries: fs.Int("hook-retries", 2, "Retries of a failing hook with -hook-failure retry"),
+		sidecar: fs.Bool("sidecar", false, "Write the episode metadata as JSON next to the mp3"),
+		replay:  fs.Bool("replaygain", false, "Measure the EBU R128 loudness and write ReplayGain tags"),
+	}
+	fs.Var(&f.commands, "post-hook", "Run this shell command for every new episode (repeatable)")
+	return f
+}
+
+func (f *hookFlags) stages() []stage {
+	switch *f.policy {
+	case hookIgnore, hookFail, hookRetry:
+	default:
+		fatal("unknown hook failure policy, expected ignore, fail or retry", "policy", *f.policy)
+	}
+	var stages []stage
+	for _, command := range f.commands {
+		stages = append(stages, commandStage{
+			command: command,
+			timeout: *f.timeout,
+			policy:  *f.policy,
+			retries: *f.retries,
+		})
+	}
+	return stages
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestPostHookReceivesEpisode(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	broadcastUrl := registerDavidecksDownload()
+
+	destDir := t.TempDir()
+	out := path.Join(t.TempDir(), "hook")
+	hook := commandStage{
+		command: `echo "$1|$ARCHIVER_PROGRAM_KEY|$ARCHIVER_BROADCAST_DAY" > ` + out + `.env && cat > ` + out + `.json`,
+		timeout: time.Minute,
+		policy:  hookFail,
+	}
+	reportFile := path.Join(t.TempDir(), "report.json")
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{report: reportFile, hooks: []stage{hook}, sidecar: true})
+
+	episode := readReport(t, reportFile).Episodes[0]
+	if episode.Outcome != outcomeDownloaded {
+		t.Fatalf("outcome got %q want %q (%s)", episode.Outcome, outcomeDownloaded, episode.Error)
+	}
+
+	env, err := os.ReadFile(out + ".env")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := episode.Path + "|4DD|20260620\n"; string(env) != want {
+		t.Errorf("hook env got %q want %q", env, want)
+	}
+
+	var stdin, sidecar episodeMetadata
+	readJson(t, out+".json", &stdin)
+	readJson(t, sidecarPath(episode.Path), &sidecar)
+	for _, meta := range []episodeMetadata{stdin, sidecar} {
+		if meta.Path != episode.Path || meta.ProgramKey != "4DD" || meta.Cover == "" || len(meta.Segments) != 2 {
+			t.Errorf("unexpected metadata %+v", meta)
+		}
+	}
+
+	// Hooks only run for new files.
+	if err := os.Remove(out + ".env"); err != nil {
+		t.Fatal(err)
+	}
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{hooks: []stage{hook}})
+	if _, err := os.Stat(out + ".env"); !os.IsNotExist(err) {
+		t.Error("expected the hook to be skipped for an archived episode")
+	}
+}
+
+func TestPostHookFailurePolicies(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	broadcastUrl := registerDavidecksDownload()
+
+	var slept []time.Duration
+	defer func(f func(time.Duration)) { sleep = f }(sleep)
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+
+	// Fails on the first call, succeeds on the second.
+	counter := path.Join(t.TempDir(), "attempts")
+	flaky := `echo x >> ` + counter + ` && [ $(wc -l < ` + counter + `) -ge 2 ] || { echo boom; exit 3; }`
+
+	tests := []struct {
+		name     string
+		hook     commandStage
+		outcome  string
+		attempts int
+	}{
+		{"fail", commandStage{command: flaky, policy: hookFail}, outcomeFailed, 1},
+		{"ignore", commandStage{command: flaky, policy: hookIgnore}, outcomeDownloaded, 1},
+		{"retry", commandStage{command: flaky, policy: hookRetry, retries: 2}, outcomeDownloaded, 2},
+		{"timeout", commandStage{command: "sleep 5", policy: hookFail, timeout: 100 * time.Millisecond}, outcomeFailed, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_ = os.Remove(counter)
+			slept = nil
+			reportFile := path.Join(t.TempDir(), "report.json")
+			destDir := t.TempDir()
+			opts := downloadOptions{report: reportFile, hooks: []stage{tt.hook}, sidecar: true}
+			downloadBroadcasts([]string{broadcastUrl}, destDir, opts)
+
+			episode := readReport(t, reportFile).Episodes[0]
+			if episode.Outcome != tt.outcome {
+				t.Errorf("outcome got %q want %q", episode.Outcome, tt.outcome)
+			}
+			if tt.outcome == outcomeFailed {
+				if episode.Error == "" {
+					t.Error("expected the hook error to be reported")
+				}
+				_, err := os.Stat(episode.Path)
+				_, sidecarErr := os.Stat(sidecarPath(episode.Path))
+				if !os.IsNotExist(err) || !os.IsNotExist(sidecarErr) {
+					t.Errorf("expected the failed episode to be left out of the archive, got %v, %v", err, sidecarErr)
+				}
+			}
+			if tt.name == "fail" && !strings.Contains(episode.Error, "boom") {
+				t.Errorf("expected the hook output in the error, got %q", episode.Error)
+			}
+			if tt.attempts > 0 {
+				data, _ := os.ReadFile(counter)
+				if got := strings.Count(string(data), "x"); got != tt.attempts {
+					t.Errorf("attempts got %d want %d", got, tt.attempts)
+				}
+				if len(slept) != tt.attempts-1 {
+					t.Errorf("retry pauses got %d want %d", len(slept), tt.attempts-1)
+				}
+			}
+			if tt.name == "fail" {
+				// The flaky hook succeeds the second time, so the next run
+				// retries and archives the episode.
+				downloadBroadcasts([]string{broadcastUrl}, destDir, opts)
+				if retried := readReport(t, reportFile).Episodes[0]; retried.Outcome != outcomeDownloaded {
+					t.Errorf("expected the next run to retry the hook, got %+v", retried)
+				}
+			}
+		})
+	}
+}
+
+func readJson(t *testing.T, file string, v any) {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArchivedEpisodeNotRetagged(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	broadcastUrl := registerDavidecksDownload()
+
+	destDir := t.TempDir()
+	reportFile := path.Join(t.TempDir(), "report.json")
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{report: reportFile})
+	episodePath := readReport(t, reportFile).Episodes[0].Path
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(episodePath, past, past); err != nil {
+		t.Fatal(err)
+	}
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{})
+	info, err := os.Stat(episodePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Errorf("expected the archived episode to be left alone, modified at %s", info.ModTime())
+	}
+}
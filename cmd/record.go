@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// fm4LiveUrl is FM4's live mp3 stream.
+const fm4LiveUrl = "https://orf-live.ors-shoutcast.at/fm4-q2a"
+
+// reconnectDelay is the pause before reconnecting to a dropped live stream.
+var reconnectDelay = 2 * time.Second
+
+type recordOptions struct {
+	liveUrl  string
+	preRoll  time.Duration
+	postRoll time.Duration
+	// days is how many days of the schedule are searched for the next airing.
+	days     int
+	download downloadOptions
+}
+
+// Record waits for the next airing of the referenced show, records it from
+// the live stream and runs it through the post-processing pipeline like a
+// download. It is for broadcasts that never become available on demand.
+func Record(showRef string, destDir string, opts recordOptions) {
+	programKey := resolveShowRef(showRef)
+	if programKey == "" {
+		return
+	}
+	broadcast, ok := nextAiring(programKey, opts.days)
+	if !ok {
+		slog.Warn("No upcoming airing in the schedule", "programKey", programKey, "days", opts.days)
+		return
+	}
+	if opts.download.dryRun {
+		printRecordPlan(os.Stdout, broadcast, destDir, opts)
+		return
+	}
+	recordBroadcast(broadcast, destDir, opts)
+}
+
+// printRecordPlan prints when the broadcast would be recorded and to where.
+func printRecordPlan(w io.Writer, broadcast Broadcast, destDir string, opts recordOptions) {
+	show := createShow(broadcast)
+	path := getFilePath(destDir, show)
+	exists, err := fileExists(path)
+	logError(err)
+
+	_, _ = fmt.Fprintf(w, "\n%s - %s\n", show.Title, show.BroadcastDay)
+	_, _ = fmt.Fprintf(w, "  path:     %s\n", path)
+	if exists {
+		_, _ = fmt.Fprintln(w, "  action:   skip (already archived)")
+		return
+	}
+	start, end := broadcast.StartISO.Add(-opts.preRoll), broadcast.EndISO.Add(opts.postRoll)
+	_, _ = fmt.Fprintf(w, "  action:   record %s from %s to %s\n", opts.liveUrl,
+		start.Local().Format(YYYYMMDD+" "+HHMMSS24h), end.Local().Format(HHMMSS24h))
+}
+
+// nextAiring returns the first broadcast of the program that has not ended
+// yet, searching the schedule from yesterday (a broadcast day runs past
+// midnight) up to days ahead.
+func nextAiring(programKey string, days int) (Broadcast, bool) {
+	today := now()
+	for d := -1; d <= days; d++ {
+		day, _ := strconv.Atoi(today.AddDate(0, 0, d).Format(broadcastDayLayout))
+		for _, b := range getDaySchedule("fm4", day) {
+			if b.ProgramKey == programKey && b.EndISO.After(today) {
+				slog.Info("Found next airing", "title", trim(b.Title), "start", b.StartISO, "end", b.EndISO,
+					"onDemand", b.IsOnDemand)
+				return b, true
+			}
+		}
+	}
+	return Broadcast{}, false
+}
+
+// recordBroadcast records the broadcast below destDir, where a download of it
+// would be stored, and post-processes it.
+func recordBroadcast(broadcast Broadcast, destDir string, opts recordOptions) {
+	show := createShow(broadcast)
+	report := newRunReport(opts.download.report)
+	entry := report.add(broadcast)
+	entry.Path = getFilePath(destDir, show)
+
+	existing, err := fileExists(entry.Path)
+	logError(err)
+	ep := &processedEpisode{
+		broadcast: broadcast,
+		show:      show,
+		destDir:   destDir,
+		path:      entry.Path,
+		existing:  existing,
+		report:    entry,
+	}
+
+	entry.Outcome = outcomeExists
+	if existing {
+		slog.Info("File already exists. Skipping recording.", "path", entry.Path)
+	} else {
+		start, end := broadcast.StartISO.Add(-opts.preRoll), broadcast.EndISO.Add(opts.postRoll)
+		if wait := start.Sub(now()); wait > 0 {
+			slog.Info("Waiting for the broadcast to start", "title", show.Title, "start", start, "in", wait.Round(time.Second))
+			sleep(wait)
+		}
+		started := time.Now()
+		logError(makeDirectoryIfNotExisting(filepath.Dir(entry.Path)))
+		logError(recordStream(opts.liveUrl, end, entry.Path))
+		entry.Outcome = outcomeDownloaded
+		entry.DownloadTime = time.Since(started).Milliseconds()
+		entry.Duration = time.Since(started).Milliseconds()
+		if info, err := os.Stat(entry.Path); err == nil {
+			entry.Bytes = info.Size()
+		}
+	}
+
+	postProcess(ep, postProcessing(opts.download), opts.download)
+	slog.Info("Processed episode",
+		"title", entry.Title,
+		"broadcastDay", entry.BroadcastDay,
+		"outcome", entry.Outcome,
+		"bytes", entry.Bytes,
+		"path", entry.Path)
+
+	report.write()
+	observeReport(report)
+	notifyReport(opts.download.notify, report)
+}
+
+// recordStream records the live stream to path until end, reconnecting when
+// the stream drops. Every connection is recorded to a piece of its own that
+// is trimmed to whole mp3 frames, so the pieces join without broken frames.
+func recordStream(liveUrl string, end time.Time, path string) error {
+	partPath := path + ".part"
+	out, err := os.Create(partPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	slog.Info("Recording live stream", "url", liveUrl, "until", end, "path", path)
+	for piece := 0; now().Before(end); piece++ {
+		piecePath := fmt.Sprintf("%s.%d", partPath, piece)
+		err := recordPiece(liveUrl, end, piecePath)
+		if err := appendFrames(out, piecePath); err != nil {
+			slog.Warn("Dropping a piece of the recording", "error", err)
+		}
+		if err == nil || !now().Before(end) {
+			break
+		}
+		slog.Warn("Live stream dropped, reconnecting", "error", err)
+		sleep(reconnectDelay)
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	scan, err := scanFrames(partPath)
+	if err != nil {
+		return err
+	}
+	if scan.frames == 0 {
+		return fmt.Errorf("recorded no mp3 frames from %s", liveUrl)
+	}
+	return os.Rename(partPath, path)
+}
+
+func recordPiece(liveUrl string, end time.Time, piecePath string) error {
+	out, err := os.Create(piecePath)
+	if err != nil {
+		return err
+	}
+	err = recordUntil(liveUrl, end, out)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// recordUntil copies the live stream to out until end. It returns nil once
+// end is reached and an error if the stream ends or fails before.
+func recordUntil(liveUrl string, end time.Time, out io.Writer) error {
+	ctx, cancel := context.WithTimeout(context.Background(), end.Sub(now()))
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", liveUrl, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Referer", "https://sound.orf.at/")
+	resp, err := http.DefaultClient.Do(req)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	// Not throttled: a live stream comes in real time, and capping it below
+	// its bitrate would lose audio.
+	_, err = io.Copy(out, resp.Body)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// appendFrames appends the whole mp3 frames of a recorded piece to out and
+// removes the piece. A recording starts and stops at arbitrary bytes, so a
+// piece may begin and end inside a frame.
+func appendFrames(out io.Writer, piecePath string) error {
+	defer os.Remove(piecePath)
+	scan, err := scanFrames(piecePath)
+	if err != nil || scan.frames == 0 {
+		return err
+	}
+	in, err := os.Open(piecePath)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	_, err = io.Copy(out, io.NewSectionReader(in, scan.audioStart, scan.audioEnd-scan.audioStart))
+	return err
+}
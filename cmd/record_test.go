@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2"
+	"github.com/jarcoal/httpmock"
+)
+
+// fakeLiveStream serves show.mp3 in a loop like a live stream, starting
+// mid-frame. The first connection drops early.
+func fakeLiveStream(connections *atomic.Int32) *httptest.Server {
+	data := httpmock.File("../_testdata/show.mp3").Bytes()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		first := connections.Add(1) == 1
+		w.Header().Set("Content-Type", "audio/mpeg")
+		for pos, sent := 1000, 0; ; sent++ {
+			if first && sent == 10 {
+				return
+			}
+			chunk := data[pos:min(pos+4096, len(data))]
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			pos = (pos + len(chunk)) % len(data)
+			select {
+			case <-req.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+}
+
+func TestRecord(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterNoResponder(httpmock.InitialTransport.RoundTrip)
+	defer func(d time.Duration) { reconnectDelay = d }(reconnectDelay)
+	reconnectDelay = 10 * time.Millisecond
+
+	var connections atomic.Int32
+	live := fakeLiveStream(&connections)
+	defer live.Close()
+
+	start, end := time.Now().Add(-time.Second), time.Now().Add(time.Second)
+	schedule := fmt.Sprintf(`{"payload": [
+		{"href": "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/50000", "station": "fm4", "id": 50000,
+		 "broadcastDay": %s, "programKey": "4LIVE", "title": "Live Special", "isOnDemand": false,
+		 "start": %q, "end": %q}
+	]}`, start.Format(broadcastDayLayout), start.UTC().Format(time.RFC3339Nano), end.UTC().Format(time.RFC3339Nano))
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://audioapi\.orf\.at/fm4/api/json/5\.0/broadcasts/\d{8}$`),
+		httpmock.NewStringResponder(200, schedule))
+
+	destDir := t.TempDir()
+	reportFile := path.Join(t.TempDir(), "report.json")
+	Record("4LIVE", destDir, recordOptions{
+		liveUrl:  live.URL,
+		days:     1,
+		download: downloadOptions{report: reportFile},
+	})
+
+	episode := readReport(t, reportFile).Episodes[0]
+	if episode.Outcome != outcomeDownloaded || episode.Bytes == 0 {
+		t.Fatalf("expected a recording, got %+v", episode)
+	}
+	if connections.Load() < 2 {
+		t.Errorf("expected a reconnect after the dropped stream, got %d connections", connections.Load())
+	}
+	scan, err := scanFrames(episode.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problems := scan.problems(); len(problems) > 0 {
+		t.Errorf("expected whole frames only, got %v", problems)
+	}
+	tag, err := id3v2.Open(episode.Path, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	if want := "Live Special - " + start.Format(broadcastDayLayout); tag.Title() != want {
+		t.Errorf("title got %q want %q", tag.Title(), want)
+	}
+}
+
+func TestRecordDryRun(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	defer func(f func(time.Duration)) { sleep = f }(sleep)
+	sleep = func(time.Duration) { t.Fatal("a dry run must not wait for the broadcast") }
+
+	start := time.Now().Add(time.Hour)
+	schedule := fmt.Sprintf(`{"payload": [
+		{"href": "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/50000", "station": "fm4", "id": 50000,
+		 "broadcastDay": %s, "programKey": "4LIVE", "title": "Live Special", "isOnDemand": false,
+		 "start": %q, "end": %q}
+	]}`, start.Format(broadcastDayLayout), start.UTC().Format(time.RFC3339Nano), start.Add(time.Hour).UTC().Format(time.RFC3339Nano))
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://audioapi\.orf\.at/fm4/api/json/5\.0/broadcasts/\d{8}$`),
+		httpmock.NewStringResponder(200, schedule))
+
+	destDir := t.TempDir()
+	Record("4LIVE", destDir, recordOptions{liveUrl: fm4LiveUrl, days: 1, download: downloadOptions{dryRun: true}})
+	if entries, _ := os.ReadDir(destDir); len(entries) != 0 {
+		t.Errorf("dry run created %d entries", len(entries))
+	}
+
+	var out bytes.Buffer
+	broadcast, _ := nextAiring("4LIVE", 1)
+	printRecordPlan(&out, broadcast, destDir, recordOptions{liveUrl: fm4LiveUrl})
+	if !strings.Contains(out.String(), "action:   record "+fm4LiveUrl) {
+		t.Errorf("output got %s", out.String())
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// refineFrame is the resolution in milliseconds of the energy analysis used to
+// refine the cut boundaries.
+const refineFrame = 10
+
+// refineSegments moves every cut boundary of segs to the quietest point within
+// tolerance of it, so cuts land in the pause before a song or after a jingle
+// instead of wherever the item metadata put them. The start and end of the
+// stream are left alone. A boundary whose window cannot be fetched or decoded
+// keeps its position.
+func refineSegments(show Show, segs []segment, tolerance time.Duration) []segment {
+	tol := tolerance.Milliseconds()
+	if tol <= 0 || len(segs) == 0 {
+		return segs
+	}
+	length := show.Streams[0].End - show.Streams[0].Start
+
+	refined := make([]segment, len(segs))
+	copy(refined, segs)
+	for i := range refined {
+		if refined[i].offset > 0 {
+			refined[i].offset = snapToSilence(show, refined[i].offset, tol)
+		}
+		if refined[i].offsetEnd < length {
+			refined[i].offsetEnd = snapToSilence(show, refined[i].offsetEnd, tol)
+		}
+	}
+
+	// Cuts shorter than twice the tolerance may have been snapped across each
+	// other.
+	for i, seg := range refined {
+		if seg.offset >= seg.offsetEnd || (i > 0 && seg.offset < refined[i-1].offsetEnd) {
+			slog.Warn("Refined cuts overlap, keeping the original boundaries", "title", show.Title, "broadcastDay", show.BroadcastDay)
+			return segs
+		}
+	}
+	return refined
+}
+
+// snapToSilence returns the quietest point within tol milliseconds of the
+// boundary offset.
+func snapToSilence(show Show, boundary int64, tol int64) int64 {
+	start := max(boundary-tol, 0)
+	energies, err := windowEnergies(getSegmentUrl(show, segment{start, boundary + tol}))
+	if err != nil {
+		slog.Warn("Could not refine cut, keeping it", "offset", boundary, "error", err)
+		return boundary
+	}
+	// The range download is cut at mp3 frame granularity; ignore any excess.
+	energies = energies[:min(len(energies), int((boundary+tol-start)/refineFrame))]
+	frame := quietestFrame(energies, int((boundary-start)/refineFrame))
+	if frame < 0 {
+		return boundary
+	}
+	snapped := start + int64(frame)*refineFrame + refineFrame/2
+	slog.Debug("Refined cut", "title", show.Title, "offset", boundary, "refined", snapped)
+	return snapped
+}
+
+// quietestFrame returns the frame closest to center among those within 3 dB of
+// the quietest one, or -1 if there are none.
+func quietestFrame(energies []float64, center int) int {
+	if len(energies) == 0 {
+		return -1
+	}
+	quietest := energies[0]
+	for _, e := range energies {
+		quietest = min(quietest, e)
+	}
+	best := -1
+	for i, e := range energies {
+		if e <= quietest*2 && (best < 0 || abs(i-center) < abs(best-center)) {
+			best = i
+		}
+	}
+	return best
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// windowEnergies downloads a short range of the stream and returns its mean
+// square energy per refineFrame milliseconds.
+func windowEnergies(url string) ([]float64, error) {
+	decoder, body, err := openStream(url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	frameLength := decoder.SampleRate() * refineFrame / 1000
+	var energies []float64
+	var sum float64
+	var count int
+	err = decoder.each(func(left, right float64) {
+		sum += left*left + right*right
+		count++
+		if count == frameLength {
+			energies = append(energies, sum/float64(2*frameLength))
+			sum, count = 0, 0
+		}
+	})
+	return energies, err
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestQuietestFrame(t *testing.T) {
+	energies := []float64{5, 4, 1, 3, 1.5, 6}
+	// Frames 2 and 4 are within 3 dB of the quietest; the closer one wins.
+	if got := quietestFrame(energies, 5); got != 4 {
+		t.Errorf("got %d want 4", got)
+	}
+	if got := quietestFrame(energies, 0); got != 2 {
+		t.Errorf("got %d want 2", got)
+	}
+	if got := quietestFrame(nil, 0); got != -1 {
+		t.Errorf("got %d want -1", got)
+	}
+}
+
+func TestRefineSegments(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+
+	var windows []string
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://loopstreamfm4\.apa\.at`),
+		func(req *http.Request) (*http.Response, error) {
+			windows = append(windows, req.URL.Query().Get("offset")+"-"+req.URL.Query().Get("offsetende"))
+			return httpmock.NewBytesResponse(200, httpmock.File("../_testdata/show.mp3").Bytes()), nil
+		},
+	)
+
+	show := Show{Streams: []Streams{{
+		Start:       1000000,
+		End:         1100000,
+		Progressive: "https://loopstreamfm4.apa.at/?channel=fm4&id=show.mp3",
+	}}}
+	segs := []segment{{0, 40000}, {50000, 100000}}
+
+	got := refineSegments(show, segs, 2*time.Second)
+
+	sort.Strings(windows)
+	if want := []string{"38000-42000", "48000-52000"}; len(windows) != 2 || windows[0] != want[0] || windows[1] != want[1] {
+		t.Errorf("windows got %v want %v", windows, want)
+	}
+	if got[0].offset != 0 || got[1].offsetEnd != 100000 {
+		t.Errorf("the stream start and end must not move, got %+v", got)
+	}
+	for i, seg := range got {
+		for _, d := range []int64{seg.offset - segs[i].offset, seg.offsetEnd - segs[i].offsetEnd} {
+			if d < -2000 || d > 2000 {
+				t.Errorf("segment %d moved beyond the tolerance: %+v", i, seg)
+			}
+		}
+	}
+
+	// Without a usable window the cuts stay where they are.
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://loopstreamfm4\.apa\.at`),
+		httpmock.NewStringResponder(404, ""))
+	got = refineSegments(show, segs, 2*time.Second)
+	if got[0] != segs[0] || got[1] != segs[1] {
+		t.Errorf("got %+v want %+v", got, segs)
+	}
+
+	if got := refineSegments(show, segs, 0); &got[0] != &segs[0] {
+		t.Error("expected no refinement without a tolerance")
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/bogem/id3v2"
+)
+
+// What to do with an episode that repeats an archived one.
+const (
+	repeatKeep = "keep" // archive it like any other episode
+	repeatTag  = "tag"  // archive it, tagged as a repeat of the original
+	repeatSkip = "skip" // don't archive it
+	repeatLink = "hardlink"
+)
+
+// contentItemsFrame is the TXXX frame holding the content items of an episode,
+// for recognising its repeats later.
+const contentItemsFrame = "FM4_CONTENT_ITEMS"
+
+// repeatOfFrame is the TXXX frame naming the original of a repeat.
+const repeatOfFrame = "FM4_REPEAT_OF"
+
+// contentItem is the part of a broadcast item that stays the same when an
+// episode is aired again.
+type contentItem struct {
+	Type        string `json:"type"`
+	Title       string `json:"title,omitempty"`
+	Interpreter string `json:"interpreter,omitempty"`
+	Duration    int    `json:"duration"`
+}
+
+// contentItems returns the items of an episode without the news and spots,
+// which change with every airing.
+func contentItems(items []Items) []contentItem {
+	var content []contentItem
+	for _, item := range items {
+		if removeTypes[item.Type] {
+			continue
+		}
+		content = append(content, contentItem{
+			Type:        item.Type,
+			Title:       trim(item.Title),
+			Interpreter: trim(item.Interpreter),
+			Duration:    item.Duration,
+		})
+	}
+	return content
+}
+
+// sameContent reports whether two episodes have the same content: at least two
+// items, of which 80% agree in order, type, title, interpreter and duration
+// within two seconds.
+func sameContent(a, b []contentItem) bool {
+	if len(a) < 2 || len(a) != len(b) {
+		return false
+	}
+	matched := 0
+	for i := range a {
+		if a[i].Type == b[i].Type && a[i].Title == b[i].Title && a[i].Interpreter == b[i].Interpreter &&
+			abs(a[i].Duration-b[i].Duration) <= 2000 {
+			matched++
+		}
+	}
+	return matched*10 >= len(a)*8
+}
+
+// markedAsRepeat reports whether ORF's texts call the broadcast a repeat.
+func markedAsRepeat(broadcast Broadcast) bool {
+	for _, text := range []string{broadcast.Subtitle, broadcast.PressRelease} {
+		if strings.Contains(strings.ToLower(text), "wiederholung") {
+			return true
+		}
+	}
+	return false
+}
+
+// archivedEpisode is an episode of the repeat index.
+type archivedEpisode struct {
+	path         string
+	broadcastDay int
+	items        []contentItem
+}
+
+// repeatIndex knows the content of the archived episodes, loaded per show
+// directory on first use and extended while a run archives more.
+type repeatIndex struct {
+	loaded   map[string]bool
+	episodes []archivedEpisode
+}
+
+func newRepeatIndex() *repeatIndex {
+	return &repeatIndex{loaded: map[string]bool{}}
+}
+
+// load reads the content items of every mp3 of a show directory.
+func (idx *repeatIndex) load(showDir string) {
+	if idx.loaded[showDir] {
+		return
+	}
+	idx.loaded[showDir] = true
+	files, _ := filepath.Glob(filepath.Join(showDir, "*", "*.mp3"))
+	for _, file := range files {
+		tag, err := id3v2.Open(file, id3v2.Options{Parse: true, ParseFrames: []string{"TXXX"}})
+		if err != nil {
+			slog.Warn("Could not read tags, ignoring for repeat detection", "path", file, "error", err)
+			continue
+		}
+		var items []contentItem
+		for _, f := range tag.GetFrames("TXXX") {
+			if udtf, ok := f.(id3v2.UserDefinedTextFrame); ok && udtf.Description == contentItemsFrame {
+				_ = json.Unmarshal([]byte(udtf.Value), &items)
+			}
+		}
+		_ = tag.Close()
+		idx.add(file, broadcastDayOf(file), items)
+	}
+}
+
+func (idx *repeatIndex) add(path string, broadcastDay int, items []contentItem) {
+	if len(items) == 0 {
+		return
+	}
+	for i, episode := range idx.episodes {
+		if episode.path == path {
+			idx.episodes[i].items = items
+			return
+		}
+	}
+	idx.episodes = append(idx.episodes, archivedEpisode{path, broadcastDay, items})
+}
+
+// originalOf returns the earliest archived episode aired before the broadcast
+// with the same content.
+func (idx *repeatIndex) originalOf(broadcast Broadcast, showDir string) (archivedEpisode, bool) {
+	idx.load(showDir)
+	items := contentItems(broadcast.Items)
+	var original archivedEpisode
+	found := false
+	for _, episode := range idx.episodes {
+		if episode.broadcastDay >= broadcast.BroadcastDay || !sameContent(items, episode.items) {
+			continue
+		}
+		if !found || episode.broadcastDay < original.broadcastDay {
+			original, found = episode, true
+		}
+	}
+	return original, found
+}
+
+// broadcastDayOf parses the broadcast day from a Title_YYYYMMDD.mp3 file name.
+func broadcastDayOf(path string) int {
+	name := strings.TrimSuffix(filepath.Base(path), ".mp3")
+	day, _ := strconv.Atoi(name[strings.LastIndex(name, "_")+1:])
+	return day
+}
+
+// sameAudio compares a 20s probe of the broadcast's content with the same
+// stretch of the original file, allowing two minutes of shift either way for
+// differently placed cuts.
+func sameAudio(show Show, segs []segment, originalPath string) (bool, error) {
+	const probeLength, slack = 20000, 120000
+	if len(segs) == 0 {
+		segs = []segment{{0, show.Streams[0].End - show.Streams[0].Start}}
+	}
+	first := segs[0]
+	probeAt := min(5*60*1000, (first.offsetEnd-first.offset-probeLength)/2)
+	if probeAt < 0 {
+		return false, fmt.Errorf("content too short for an audio comparison")
+	}
+
+	probe, err := fingerprintStream(getSegmentUrl(show, segment{first.offset + probeAt, first.offset + probeAt + probeLength}))
+	if err != nil {
+		return false, err
+	}
+
+	file, err := os.Open(originalPath)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+	decoder, err := newPcmDecoder(file)
+	if err != nil {
+		return false, err
+	}
+	from := max(0, probeAt-slack)
+	bytesPerMs := int64(decoder.SampleRate()) * 4 / 1000
+	if _, err := decoder.Seek(from*bytesPerMs, io.SeekStart); err != nil {
+		return false, err
+	}
+	original := newFingerprinter(decoder.SampleRate())
+	window := io.LimitReader(decoder, (probeAt+probeLength+slack-from)*bytesPerMs)
+	if err := eachSample(window, original.add); err != nil {
+		return false, err
+	}
+	return len(original.fingerprint().find(probe)) > 0, nil
+}
+
+// findOriginal looks the broadcast up in the index and, with -repeat-audio,
+// confirms the match by comparing the audio of new episodes.
+func findOriginal(ep *processedEpisode, index *repeatIndex, opts downloadOptions) (archivedEpisode, bool) {
+	broadcast := ep.broadcast
+	original, found := index.originalOf(broadcast, filepath.Join(ep.destDir, ep.show.TitleSanitized))
+	if !found {
+		if markedAsRepeat(broadcast) {
+			slog.Info("Broadcast is marked as a repeat, but its original is not archived",
+				"title", ep.show.Title, "broadcastDay", broadcast.BroadcastDay)
+		}
+		return original, false
+	}
+
+	if opts.repeatAudio && !ep.existing {
+		same, err := sameAudio(ep.show, contentSegments(ep.show), original.path)
+		if err != nil {
+			slog.Warn("Could not compare the audio, trusting the metadata", "path", original.path, "error", err)
+		} else if !same {
+			slog.Info("Metadata match a repeat, but the audio differs", "title", ep.show.Title,
+				"broadcastDay", broadcast.BroadcastDay, "original", original.path)
+			return original, false
+		}
+	}
+	return original, true
+}
+
+// checkRepeat looks the broadcast up in the index and applies the repeat
+// policy. Returns true if the episode is fully handled and must not be
+// downloaded.
+func checkRepeat(ep *processedEpisode, index *repeatIndex, opts downloadOptions) bool {
+	broadcast := ep.broadcast
+	original, found := findOriginal(ep, index, opts)
+	if !found {
+		return false
+	}
+
+	slog.Info("Episode repeats an archived one", "title", ep.show.Title,
+		"broadcastDay", broadcast.BroadcastDay, "original", original.path, "action", opts.repeats)
+	ep.repeatOf = original.path
+	ep.report.RepeatOf = original.path
+
+	switch opts.repeats {
+	case repeatSkip:
+		ep.report.Outcome = outcomeRepeat
+		return true
+	case repeatLink:
+		if !ep.existing {
+			logError(makeDirectoryIfNotExisting(filepath.Dir(ep.path)))
+			if err := os.Link(original.path, ep.path); err != nil {
+				slog.Error("Could not hardlink the repeat", "path", ep.path, "original", original.path, "error", err)
+				return false
+			}
+		}
+		ep.report.Outcome = outcomeRepeat
+		// The file is the original's; re-tagging it would change both.
+		return true
+	}
+	return false
+}
+
+// repeatStage tags a repeat with its original.
+type repeatStage struct{}
+
+func (repeatStage) name() string { return "repeat" }
+
+func (repeatStage) run(ep *processedEpisode) error {
+	if ep.repeatOf == "" {
+		return nil
+	}
+	tag, err := id3v2.Open(ep.path, id3v2.Options{Parse: true})
+	if err != nil {
+		return err
+	}
+	defer tag.Close()
+	tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+		Encoding:    id3v2.EncodingUTF8,
+		Description: repeatOfFrame,
+		Value:       filepath.Base(ep.repeatOf),
+	})
+	return tag.Save()
+}
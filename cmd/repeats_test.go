@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/bogem/id3v2"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestSameContent(t *testing.T) {
+	items := []Items{
+		{Type: "N", Title: "News", Duration: 248500},
+		{Type: "B", Title: "Sleepless", Duration: 3312500},
+		{Type: "W", Duration: 52000},
+		{Type: "B", Title: "Sleepless", Duration: 3540000},
+	}
+	original := contentItems(items)
+	if len(original) != 2 {
+		t.Fatalf("got %+v, want the two content items", original)
+	}
+
+	repeat := contentItems(items)
+	repeat[1].Duration += 1500
+	if !sameContent(original, repeat) {
+		t.Error("expected durations within 2s to match")
+	}
+	repeat[1].Duration += 1000
+	if sameContent(original, repeat) {
+		t.Error("expected one of two items off by 2.5s not to match")
+	}
+	if sameContent(original[:1], original[:1]) {
+		t.Error("a single item is too weak to call a repeat")
+	}
+}
+
+func TestBroadcastDayOf(t *testing.T) {
+	if got := broadcastDayOf("/music/Sleepless/2026/Sleepless_20260620.mp3"); got != 20260620 {
+		t.Errorf("got %d", got)
+	}
+}
+
+// registerRepeat mocks a rebroadcast of the Davidecks broadcast 42628 a week
+// later as broadcast 42700.
+func registerRepeat() string {
+	repeatUrl := "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42700"
+	data := string(httpmock.File("../_testdata/broadcast_42628_full_v5.json").Bytes())
+	data = strings.NewReplacer("42628", "42700", "20260620", "20260627").Replace(data)
+	httpmock.RegisterResponder("GET", repeatUrl+"?items=1000",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewStringResponse(200, data), nil
+		},
+	)
+	return repeatUrl
+}
+
+func TestRepeats(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	urls := []string{registerDavidecksDownload(), registerRepeat()}
+
+	for _, policy := range []string{repeatSkip, repeatLink, repeatTag} {
+		t.Run(policy, func(t *testing.T) {
+			reportFile := path.Join(t.TempDir(), "report.json")
+			downloadBroadcasts(urls, t.TempDir(), downloadOptions{report: reportFile, repeats: policy})
+
+			report := readReport(t, reportFile)
+			original, repeat := report.Episodes[0], report.Episodes[1]
+			if original.Outcome != outcomeDownloaded || original.RepeatOf != "" {
+				t.Fatalf("unexpected original %+v", original)
+			}
+			if repeat.RepeatOf != original.Path {
+				t.Errorf("repeatOf got %q want %q", repeat.RepeatOf, original.Path)
+			}
+
+			info, err := os.Stat(repeat.Path)
+			switch policy {
+			case repeatSkip:
+				if repeat.Outcome != outcomeRepeat || !os.IsNotExist(err) {
+					t.Errorf("expected the repeat to be skipped, got %+v (%v)", repeat, err)
+				}
+			case repeatLink:
+				originalInfo, _ := os.Stat(original.Path)
+				if repeat.Outcome != outcomeRepeat || err != nil || !os.SameFile(info, originalInfo) {
+					t.Errorf("expected the repeat to be a hardlink of the original, got %+v (%v)", repeat, err)
+				}
+			case repeatTag:
+				if repeat.Outcome != outcomeDownloaded || err != nil {
+					t.Fatalf("expected the repeat to be archived, got %+v (%v)", repeat, err)
+				}
+				tag, err := id3v2.Open(repeat.Path, id3v2.Options{Parse: true})
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer tag.Close()
+				found := false
+				for _, f := range tag.GetFrames("TXXX") {
+					udtf := f.(id3v2.UserDefinedTextFrame)
+					found = found || udtf.Description == repeatOfFrame && udtf.Value == path.Base(original.Path)
+				}
+				if !found {
+					t.Errorf("expected a %s frame naming %s", repeatOfFrame, path.Base(original.Path))
+				}
+			}
+		})
+	}
+
+	// Repeats are found in the archive of earlier runs too.
+	destDir := t.TempDir()
+	downloadBroadcasts(urls[:1], destDir, downloadOptions{})
+	reportFile := path.Join(t.TempDir(), "report.json")
+	downloadBroadcasts(urls[1:], destDir, downloadOptions{report: reportFile, repeats: repeatSkip})
+	if repeat := readReport(t, reportFile).Episodes[0]; repeat.Outcome != outcomeRepeat {
+		t.Errorf("expected the archived original to be found, got %+v", repeat)
+	}
+
+	// Without a policy nothing is detected.
+	reportFile = path.Join(t.TempDir(), "report.json")
+	downloadBroadcasts(urls, t.TempDir(), downloadOptions{report: reportFile})
+	if repeat := readReport(t, reportFile).Episodes[1]; repeat.Outcome != outcomeDownloaded || repeat.RepeatOf != "" {
+		t.Errorf("expected a plain download, got %+v", repeat)
+	}
+}
+
+func TestSameAudio(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	registerDavidecksDownload()
+
+	show := Show{Streams: []Streams{{
+		Start:       1000000,
+		End:         1060000,
+		Progressive: "https://loopstreamfm4.apa.at/?channel=fm4&id=show.mp3",
+	}}}
+	same, err := sameAudio(show, nil, "../_testdata/show.mp3")
+	if err != nil || !same {
+		t.Errorf("got %v, %v want the probe to be found", same, err)
+	}
+
+	show.Streams[0].End = show.Streams[0].Start + 10000
+	if _, err := sameAudio(show, nil, "../_testdata/show.mp3"); err == nil {
+		t.Error("expected an error for content shorter than the probe")
+	}
+}
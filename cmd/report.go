@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// Outcomes of an episode in the run report.
+const (
+	outcomeDownloaded = "downloaded"
+	outcomeExists     = "exists"
+	outcomeNoStreams  = "no-streams"
+	outcomeFailed     = "failed"
+	outcomeRepeat     = "repeat"
+)
+
+// runReport is the machine-readable summary of a download run, written as
+// JSON to the -report file.
+type runReport struct {
+	Started  time.Time        `json:"started"`
+	Finished time.Time        `json:"finished"`
+	Episodes []*episodeReport `json:"episodes"`
+
+	path string
+}
+
+type episodeReport struct {
+	Title        string          `json:"title"`
+	ProgramKey   string          `json:"programKey"`
+	BroadcastDay int             `json:"broadcastDay"`
+	Href         string          `json:"href"`
+	Path         string          `json:"path,omitempty"`
+	Cover        string          `json:"cover,omitempty"`
+	Outcome      string          `json:"outcome"`
+	Bytes        int64           `json:"bytes"`
+	Duration     int64           `json:"duration"`     // milliseconds of audio kept
+	DownloadTime int64           `json:"downloadTime"` // milliseconds spent downloading
+	Segments     []segmentReport `json:"segments,omitempty"`
+	Loudness     *loudness       `json:"loudness,omitempty"`
+	RepeatOf     string          `json:"repeatOf,omitempty"`
+	Error        string          `json:"error,omitempty"`
+}
+
+type segmentReport struct {
+	Offset    int64 `json:"offset"`
+	OffsetEnd int64 `json:"offsetEnd"`
+}
+
+func newRunReport(path string) *runReport {
+	return &runReport{Started: time.Now(), Episodes: []*episodeReport{}, path: path}
+}
+
+// add starts the report entry of a broadcast. It counts as failed until the
+// caller records another outcome, so a run aborted by fatal reports it as such.
+func (r *runReport) add(broadcast Broadcast) *episodeReport {
+	episode := &episodeReport{
+		Title:        trim(broadcast.Title),
+		ProgramKey:   broadcast.ProgramKey,
+		BroadcastDay: broadcast.BroadcastDay,
+		Href:         broadcast.Href,
+		Outcome:      outcomeFailed,
+	}
+	r.Episodes = append(r.Episodes, episode)
+	return episode
+}
+
+// write stores the report as JSON if a report path was configured. Errors are
+// logged only: the report must not turn a successful run into a failed one.
+func (r *runReport) write() {
+	if r.path == "" {
+		return
+	}
+	r.Finished = time.Now()
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err == nil {
+		err = os.WriteFile(r.path, data, 0644)
+	}
+	if err != nil {
+		slog.Error("Could not write run report", "path", r.path, "error", err)
+		return
+	}
+	slog.Info("Wrote run report", "path", r.path)
+}
+
+func segmentReports(segs []segment) []segmentReport {
+	var reports []segmentReport
+	for _, seg := range segs {
+		reports = append(reports, segmentReport{Offset: seg.offset, OffsetEnd: seg.offsetEnd})
+	}
+	return reports
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"testing"
+
+	"github.com/jarcoal/httpmock"
+)
+
+// registerDavidecksDownload mocks everything a full download of the Davidecks
+// broadcast 42628 requests: the broadcast, the loopstream segments and the cover.
+func registerDavidecksDownload() string {
+	broadcastUrl := "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628"
+	httpmock.RegisterResponder("GET", broadcastUrl+"?items=1000",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/broadcast_42628_full_v5.json"))
+		},
+	)
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://loopstreamfm4\.apa\.at`),
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewBytesResponse(200, httpmock.File("../_testdata/show.mp3").Bytes()), nil
+		},
+	)
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://radiobilder\.orf\.at/`),
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewBytesResponse(200, httpmock.File("../_testdata/4DD.jpg").Bytes()), nil
+		},
+	)
+	return broadcastUrl
+}
+
+func readReport(t *testing.T, file string) runReport {
+	t.Helper()
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report runReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestRunReport(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	broadcastUrl := registerDavidecksDownload()
+
+	destDir := t.TempDir()
+	reportFile := path.Join(t.TempDir(), "report.json")
+
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{report: reportFile})
+
+	report := readReport(t, reportFile)
+	if len(report.Episodes) != 1 {
+		t.Fatalf("got %d episodes, want 1", len(report.Episodes))
+	}
+	episode := report.Episodes[0]
+	if episode.Outcome != outcomeDownloaded {
+		t.Errorf("outcome got %q want %q", episode.Outcome, outcomeDownloaded)
+	}
+	if episode.Bytes == 0 {
+		t.Error("expected the downloaded bytes to be reported")
+	}
+	wantSegments := []segmentReport{{248500, 3561000}, {3613000, 7153000}}
+	if len(episode.Segments) != 2 || episode.Segments[0] != wantSegments[0] || episode.Segments[1] != wantSegments[1] {
+		t.Errorf("segments got %+v want %+v", episode.Segments, wantSegments)
+	}
+	if want := int64(3561000 - 248500 + 7153000 - 3613000); episode.Duration != want {
+		t.Errorf("duration got %d want %d", episode.Duration, want)
+	}
+
+	// A second run finds the file and reports it as already archived.
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{report: reportFile})
+
+	if got := readReport(t, reportFile).Episodes[0].Outcome; got != outcomeExists {
+		t.Errorf("outcome of second run got %q want %q", got, outcomeExists)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// subscriptionRule selects broadcasts to archive by their metadata rather than
+// by a fixed programKey. Every set field must match; the patterns are
+// case-insensitive regular expressions.
+type subscriptionRule struct {
+	Name         string `json:"name"`
+	Title        string `json:"title,omitempty"`
+	Subtitle     string `json:"subtitle,omitempty"`
+	PressRelease string `json:"pressRelease,omitempty"`
+	// Text matches the title, the subtitle or the press release.
+	Text       string `json:"text,omitempty"`
+	ProgramKey string `json:"programKey,omitempty"`
+	Weekday    string `json:"weekday,omitempty"` // e.g. "sat,sun"
+	// Query, if set, also searches the whole on-demand window for it and
+	// matches the rule against the hits. A rule with only a query matches
+	// just its own hits.
+	Query string `json:"query,omitempty"`
+
+	title, subtitle, pressRelease, text, programKey *regexp.Regexp
+	weekdays                                        []time.Weekday
+}
+
+// loadRules reads a JSON array of subscription rules and compiles them.
+func loadRules(path string) ([]subscriptionRule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []subscriptionRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(rules) == 0 {
+		return nil, fmt.Errorf("no rules in %s", path)
+	}
+	for i := range rules {
+		if rules[i].Name == "" {
+			rules[i].Name = fmt.Sprintf("rule %d", i+1)
+		}
+		if err := rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", path, rules[i].Name, err)
+		}
+	}
+	return rules, nil
+}
+
+func (r *subscriptionRule) compile() error {
+	var err error
+	for _, p := range []struct {
+		re      **regexp.Regexp
+		pattern string
+	}{
+		{&r.title, r.Title},
+		{&r.subtitle, r.Subtitle},
+		{&r.pressRelease, r.PressRelease},
+		{&r.text, r.Text},
+		{&r.programKey, r.ProgramKey},
+	} {
+		if p.pattern == "" {
+			continue
+		}
+		if *p.re, err = regexp.Compile("(?i)" + p.pattern); err != nil {
+			return err
+		}
+	}
+	if r.weekdays, err = parseWeekdays(r.Weekday); err != nil {
+		return err
+	}
+	if r.title == nil && r.subtitle == nil && r.pressRelease == nil && r.text == nil &&
+		r.programKey == nil && r.Query == "" {
+		return fmt.Errorf("needs a pattern or a query, it would match every broadcast")
+	}
+	return nil
+}
+
+// queryOnly reports whether the rule selects broadcasts by its query alone.
+func (r subscriptionRule) queryOnly() bool {
+	return r.Query != "" && r.title == nil && r.subtitle == nil && r.pressRelease == nil &&
+		r.text == nil && r.programKey == nil
+}
+
+func (r subscriptionRule) match(c ruleCandidate) bool {
+	b := c.broadcastSummary
+	if r.queryOnly() && c.query != r.Query {
+		return false
+	}
+	if r.title != nil && !r.title.MatchString(b.Title) {
+		return false
+	}
+	if r.subtitle != nil && !r.subtitle.MatchString(b.Subtitle) {
+		return false
+	}
+	if r.pressRelease != nil && !r.pressRelease.MatchString(b.PressRelease) {
+		return false
+	}
+	if r.text != nil && !r.text.MatchString(b.Title) && !r.text.MatchString(b.Subtitle) &&
+		!r.text.MatchString(b.PressRelease) {
+		return false
+	}
+	if r.programKey != nil && !r.programKey.MatchString(b.ProgramKey) {
+		return false
+	}
+	if len(r.weekdays) > 0 && !containsWeekday(r.weekdays, b.weekday()) {
+		return false
+	}
+	return true
+}
+
+type subscribeOptions struct {
+	rules []subscriptionRule
+	// days is how many broadcast days of the schedule, counting back from
+	// today, the rules are evaluated against.
+	days     int
+	download downloadOptions
+}
+
+// Subscribe downloads every broadcast of the recent schedule, and of the
+// search results of the rules' queries, that matches a subscription rule and
+// is available on demand.
+func Subscribe(destDir string, opts subscribeOptions) {
+	matches := matchRules(opts.rules, ruleCandidates(opts))
+	if len(matches) == 0 {
+		slog.Info("No broadcasts match the rules.")
+	}
+	downloadBroadcasts(hrefs(matches), destDir, opts.download)
+	for _, rule := range opts.rules {
+		markSuccessfulRun("rule:" + rule.Name)
+	}
+}
+
+// ruleCandidate is a broadcast the rules are matched against, with the query
+// whose search found it; empty for broadcasts of the schedule.
+type ruleCandidate struct {
+	broadcastSummary
+	query string
+}
+
+func ruleCandidates(opts subscribeOptions) []ruleCandidate {
+	var candidates []ruleCandidate
+	today := now()
+	for d := opts.days - 1; d >= 0; d-- {
+		day, _ := strconv.Atoi(today.AddDate(0, 0, -d).Format(broadcastDayLayout))
+		for _, b := range getDaySchedule("fm4", day) {
+			candidates = append(candidates, ruleCandidate{broadcastSummary: b.toSummary()})
+		}
+	}
+	for _, rule := range opts.rules {
+		if rule.Query == "" {
+			continue
+		}
+		result, err := getSearchResults(rule.Query)
+		logError(err)
+		for _, hit := range result.Hits {
+			if hit.Data.Entity == "Broadcast" {
+				candidates = append(candidates, ruleCandidate{hit.toSummary(), rule.Query})
+			}
+		}
+	}
+	return candidates
+}
+
+// matchRules returns the candidates available on demand that match a rule,
+// each broadcast once.
+func matchRules(rules []subscriptionRule, candidates []ruleCandidate) []broadcastSummary {
+	var matches []broadcastSummary
+	seen := map[int]bool{}
+	for _, c := range candidates {
+		b := c.broadcastSummary
+		if seen[b.ID] || !b.IsOnDemand {
+			continue
+		}
+		for _, rule := range rules {
+			if rule.match(c) {
+				slog.Info("Rule matches", "rule", rule.Name, "title", b.Title, "broadcastDay", b.BroadcastDay)
+				matches = append(matches, b)
+				seen[b.ID] = true
+				break
+			}
+		}
+	}
+	return matches
+}
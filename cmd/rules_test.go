@@ -0,0 +1,133 @@
+package main
+
+import (
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func writeRules(t *testing.T, rules string) string {
+	t.Helper()
+	file := path.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(file, []byte(rules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		want  string
+	}{
+		{"valid", `[{"name": "Swound Sound", "text": "swound sound"}, {"title": "live", "weekday": "fri,sat"}]`, ""},
+		{"empty", `[]`, "no rules"},
+		{"catch-all", `[{"weekday": "sat"}]`, "rule 1: needs a pattern"},
+		{"bad pattern", `[{"name": "broken", "title": "(live"}]`, "broken: error parsing regexp"},
+		{"bad weekday", `[{"title": "live", "weekday": "someday"}]`, "unknown weekday"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := loadRules(writeRules(t, tt.rules))
+			if tt.want == "" {
+				if err != nil || len(rules) != 2 || rules[1].Name != "rule 2" {
+					t.Errorf("got %+v, %v", rules, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchRules(t *testing.T) {
+	rules, err := loadRules(writeRules(t, `[
+		{"name": "Swound Sound", "text": "swound sound"},
+		{"name": "Live specials", "title": "\\blive\\b", "weekday": "sat"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saturday := time.Date(2026, 6, 20, 21, 0, 0, 0, time.UTC)
+	candidates := []broadcastSummary{
+		{ID: 1, Title: "Davidecks", Subtitle: "Mit Swound Sound", IsOnDemand: true},
+		{ID: 2, Title: "FM4 Live Special", Start: saturday, IsOnDemand: true},
+		{ID: 3, Title: "FM4 Live Special", Start: saturday.AddDate(0, 0, 1), IsOnDemand: true},
+		{ID: 4, Title: "Oliver", PressRelease: "Hits from the Swound Sound days", IsOnDemand: true},
+		{ID: 5, Title: "Swound Sound", IsOnDemand: false},
+		{ID: 6, Title: "Delivery", Start: saturday, IsOnDemand: true},
+		{ID: 1, Title: "Davidecks", Subtitle: "Mit Swound Sound", IsOnDemand: true},
+	}
+	if got, want := matchedIds(rules, scheduled(candidates)), []int{1, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+
+	// A rule with only a query matches its own search hits, not the schedule.
+	rules, err = loadRules(writeRules(t, `[{"name": "Swound Sound", "query": "Swound Sound"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withHits := append(scheduled(candidates),
+		ruleCandidate{broadcastSummary{ID: 7, Title: "Swound Sound", IsOnDemand: true}, "Swound Sound"},
+		ruleCandidate{broadcastSummary{ID: 8, Title: "Swound Sound Spezial", IsOnDemand: true}, "Spezial"},
+	)
+	if got, want := matchedIds(rules, withHits), []int{7}; !reflect.DeepEqual(got, want) {
+		t.Errorf("query-only rule got %v want %v", got, want)
+	}
+}
+
+func scheduled(broadcasts []broadcastSummary) []ruleCandidate {
+	candidates := make([]ruleCandidate, len(broadcasts))
+	for i, b := range broadcasts {
+		candidates[i] = ruleCandidate{broadcastSummary: b}
+	}
+	return candidates
+}
+
+func matchedIds(rules []subscriptionRule, candidates []ruleCandidate) []int {
+	var ids []int
+	for _, b := range matchRules(rules, candidates) {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+func TestSubscribe(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	registerDavidecksDownload()
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://audioapi\.orf\.at/fm4/api/json/5\.0/broadcasts/\d{8}$`),
+		httpmock.NewStringResponder(200, `{"payload": [
+			{"href": "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628", "station": "fm4", "id": 42628,
+			 "broadcastDay": 20260620, "programKey": "4DD", "title": "Davidecks", "isOnDemand": true,
+			 "pressRelease": "<p>Swound Sound Special</p>",
+			 "start": "2026-06-20T22:00:00+02:00", "end": "2026-06-21T00:00:00+02:00"},
+			{"href": "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42629", "station": "fm4", "id": 42629,
+			 "broadcastDay": 20260620, "programKey": "4MO", "title": "Morning Show", "isOnDemand": true,
+			 "start": "2026-06-20T06:00:00+02:00", "end": "2026-06-20T10:00:00+02:00"}
+		]}`))
+	rules, err := loadRules(writeRules(t, `[{"name": "Swound Sound", "text": "swound sound"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reportFile := path.Join(t.TempDir(), "report.json")
+	Subscribe(t.TempDir(), subscribeOptions{rules: rules, days: 2, download: downloadOptions{report: reportFile}})
+
+	episodes := readReport(t, reportFile).Episodes
+	if len(episodes) != 1 || episodes[0].Outcome != outcomeDownloaded || episodes[0].Title != "Davidecks" {
+		t.Fatalf("expected just the matching broadcast to be downloaded, got %+v", episodes)
+	}
+	if n := httpmock.GetCallCountInfo()["GET =~^https://audioapi\\.orf\\.at/fm4/api/json/5\\.0/broadcasts/\\d{8}$"]; n != 2 {
+		t.Errorf("expected the schedule of two days, got %d requests", n)
+	}
+}
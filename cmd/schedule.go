@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// scheduleOptions are the knobs of the 'schedule' subcommand.
+type scheduleOptions struct {
+	station string
+	// day is the first broadcast day shown; days is the number of days.
+	day    time.Time
+	days   int
+	filter broadcastFilter
+	format string // text, table, json or csv
+}
+
+// Schedule prints the program guide of a station: its broadcasts of one or
+// more broadcast days that pass the filter, in airing order.
+func Schedule(opts scheduleOptions) {
+	err := printBroadcasts(os.Stdout, scheduleBroadcasts(opts), opts.format)
+	logError(err)
+}
+
+// scheduleDay parses the -date of 'schedule'; empty means today.
+func scheduleDay(value string) time.Time {
+	day, err := parseBroadcastDay(value)
+	logError(err)
+	if day == 0 {
+		return now()
+	}
+	t, _ := time.ParseInLocation(broadcastDayLayout, strconv.Itoa(day), time.Local)
+	return t
+}
+
+func scheduleBroadcasts(opts scheduleOptions) []broadcastSummary {
+	var broadcasts []broadcastSummary
+	for d := 0; d < opts.days; d++ {
+		day, _ := strconv.Atoi(opts.day.AddDate(0, 0, d).Format(broadcastDayLayout))
+		for _, b := range getDaySchedule(opts.station, day) {
+			broadcasts = append(broadcasts, b.toSummary())
+		}
+	}
+	return opts.filter.apply(broadcasts)
+}
+
+// getDaySchedule fetches the broadcasts of a station's broadcast day on the
+// v5.0 API.
+func getDaySchedule(station string, broadcastDay int) []Broadcast {
+	url := fmt.Sprintf("https://audioapi.orf.at/%s/api/json/5.0/broadcasts/%d", station, broadcastDay)
+
+	response, err := http.Get(url)
+	logError(err)
+	logUnexpectedStatus(response, url)
+	defer func(Body io.ReadCloser) {
+		err := Body.Close()
+		if err != nil {
+			logError(err)
+		}
+	}(response.Body)
+
+	responseData, err := io.ReadAll(response.Body)
+	logError(err)
+
+	var wrapper struct {
+		Payload []broadcastV5 `json:"payload"`
+	}
+	err = json.Unmarshal(responseData, &wrapper)
+	logError(err)
+
+	broadcasts := make([]Broadcast, 0, len(wrapper.Payload))
+	for _, b := range wrapper.Payload {
+		broadcasts = append(broadcasts, b.toBroadcast())
+	}
+	return broadcasts
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarcoal/httpmock"
+)
+
+func TestScheduleBroadcasts(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://audioapi\.orf\.at/oe1/api/json/5\.0/broadcasts/(\d{8})$`),
+		func(req *http.Request) (*http.Response, error) {
+			day := strings.TrimPrefix(req.URL.Path, "/oe1/api/json/5.0/broadcasts/")
+			date, _ := time.Parse(broadcastDayLayout, day)
+			return httpmock.NewStringResponse(200, fmt.Sprintf(`{"payload": [
+				{"href": "https://audioapi.orf.at/oe1/api/json/5.0/broadcast/1%[1]s", "station": "oe1", "id": 1,
+				 "broadcastDay": %[1]s, "programKey": "JOUR", "title": "Morgenjournal", "isOnDemand": true,
+				 "start": "%[2]sT07:00:00+02:00", "end": "%[2]sT07:20:00+02:00"},
+				{"href": "https://audioapi.orf.at/oe1/api/json/5.0/broadcast/2%[1]s", "station": "oe1", "id": 2,
+				 "broadcastDay": %[1]s, "programKey": "JAZZ", "title": "Jazznacht", "isOnDemand": false,
+				 "start": "%[2]sT23:00:00+02:00", "end": "%[2]sT23:59:00+02:00"}
+			]}`, day, date.Format(YYYYMMDD))), nil
+		})
+
+	day := time.Date(2026, 6, 19, 0, 0, 0, 0, time.Local)
+	got := scheduleBroadcasts(scheduleOptions{station: "oe1", day: day, days: 1})
+	if len(got) != 2 || got[0].ProgramKey != "JOUR" || got[1].duration() != 59*time.Minute {
+		t.Fatalf("unexpected day schedule %+v", got)
+	}
+
+	got = scheduleBroadcasts(scheduleOptions{station: "oe1", day: day, days: 7,
+		filter: broadcastFilter{Title: "jazz", Weekdays: []time.Weekday{time.Saturday, time.Sunday}}})
+	if len(got) != 2 || got[0].BroadcastDay != 20260620 || got[1].BroadcastDay != 20260621 {
+		t.Errorf("expected the weekend's Jazznacht, got %+v", got)
+	}
+	if n := httpmock.GetTotalCallCount(); n != 8 {
+		t.Errorf("expected one request per day, got %d", n)
+	}
+
+	got = scheduleBroadcasts(scheduleOptions{station: "oe1", day: day, days: 1,
+		filter: broadcastFilter{OnDemandOnly: true}})
+	if len(got) != 1 || got[0].Title != "Morgenjournal" {
+		t.Errorf("expected the on-demand broadcast only, got %+v", got)
+	}
+}
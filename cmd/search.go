@@ -1,76 +1,429 @@
 package main
 
 import (
+	"bufio"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"text/tabwriter"
 	"time"
 )
 
-func SearchBroadcastUrls(searchQuery string) []string {
+// stdin is where interactive prompts read their answers from. Tests swap it
+// for a canned reader.
+var stdin = bufio.NewReader(os.Stdin)
 
-	fmt.Printf("   Searching for '%s' ...\n\n", searchQuery)
+// stdinIsTerminal reports whether someone can answer the prompts; tests
+// replace it.
+var stdinIsTerminal = func() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// searchOptions are the knobs of the 'search' subcommand on top of the query.
+type searchOptions struct {
+	filter      broadcastFilter
+	format      string // text, table, json or csv
+	sortBy      string // date, title or duration; empty keeps API order
+	reverse     bool
+	limit       int
+	interactive bool
+	destDir     string
+	download    downloadOptions
+}
+
+// Search runs the 'search' subcommand: it filters, sorts and prints the hits
+// for searchQuery and, in interactive mode, downloads the ones picked by the
+// user. When nothing matches but the API suggests a spelling, a user at the
+// terminal reading text or table output is offered a rerun with the top
+// suggestion.
+func Search(searchQuery string, opts searchOptions) {
+	logError(opts.validate())
 
 	parsedSearchResult, err := getSearchResults(searchQuery)
 	logError(err)
 
-	fmt.Printf("   Found following show:\n")
+	hits := searchBroadcasts(searchQuery, parsedSearchResult, opts.filter)
 
-	var result []string
+	format := opts.format
+	if opts.interactive {
+		// The picker refers to the row numbers of the table.
+		format = "table"
+	}
+
+	if len(hits) == 0 {
+		if len(parsedSearchResult.Suggest) > 0 {
+			suggestion := parsedSearchResult.Suggest[0].Text
+			if format != "json" && format != "csv" && stdinIsTerminal() {
+				if confirm(fmt.Sprintf("No results found for '%s'. Search for '%s' instead?", searchQuery, suggestion)) {
+					Search(suggestion, opts)
+					return
+				}
+			} else {
+				slog.Info("No search results!", "query", searchQuery, "suggestion", suggestion)
+			}
+		} else {
+			slog.Info("No search results!", "query", searchQuery)
+		}
+	}
+
+	sortBroadcasts(hits, opts.sortBy, opts.reverse)
+	if opts.limit > 0 && len(hits) > opts.limit {
+		hits = hits[:opts.limit]
+	}
+
+	err = printBroadcasts(os.Stdout, hits, format)
+	logError(err)
+
+	if opts.interactive && len(hits) > 0 {
+		selected, err := parseSelection(prompt("Select hits to download (e.g. 1,3-4 or all, empty to cancel):"), len(hits))
+		logError(err)
+		var picked []broadcastSummary
+		for _, i := range selected {
+			picked = append(picked, hits[i])
+		}
+		if len(picked) > 0 {
+			downloadBroadcasts(hrefs(picked), opts.destDir, opts.download)
+		}
+	}
+}
+
+// validate rejects an unknown sort key or format before anything is fetched.
+func (opts searchOptions) validate() error {
+	switch opts.sortBy {
+	case "", "date", "title", "duration":
+	default:
+		return fmt.Errorf("unknown sort key %q, expected date, title or duration", opts.sortBy)
+	}
+	switch opts.format {
+	case "", "text", "table", "json", "csv":
+	default:
+		return fmt.Errorf("unknown format %q, expected text, table, json or csv", opts.format)
+	}
+	return nil
+}
 
-	for _, hit := range parsedSearchResult.Hits {
+// searchBroadcasts returns the broadcast-level hits whose title contains the
+// query (case-insensitive) and that pass the filter.
+func searchBroadcasts(searchQuery string, result SearchResult, filter broadcastFilter) []broadcastSummary {
+	var hits []broadcastSummary
+	for _, hit := range result.Hits {
 		if hit.Data.Entity == "Broadcast" &&
 			strings.Contains(
 				strings.ToLower(hit.Data.Title),
 				strings.ToLower(searchQuery)) {
-			// The search endpoint (current/search) returns v4.0-style hrefs, but
-			// getBroadcast now consumes the v5.0 broadcast/{id} endpoint. The
-			// broadcast-level hit's id is v5.0-compatible (verified against the
-			// live API), so build the v5.0 href here; item-level hits never reach
-			// this branch (they are filtered by Entity == "Broadcast").
-			href := fmt.Sprintf("https://audioapi.orf.at/fm4/api/json/5.0/broadcast/%d", hit.Data.ID)
-			fmt.Printf("\n   Name:            %s\n", hit.Data.Title)
-			fmt.Printf("   ProgramKey:      %s\n", hit.Data.ProgramKey)
-			fmt.Printf("   BroadcastDay:    %d\n", hit.Data.BroadcastDay)
-			fmt.Printf("   Href:            %s\n", href)
-			fmt.Printf("   StartISO:        %s\n", hit.Data.StartISO)
-			fmt.Printf("   Weekday:         %s\n", hit.Data.StartISO.Weekday())
-			fmt.Printf("   Duration (min):  %d\n", int64(hit.Data.EndISO.Sub(hit.Data.StartISO).Minutes()))
-			fmt.Printf("   Offset (hours):  %f\n\n", time.Since(hit.Data.StartISO).Hours()*-1)
-
-			result = append(result, href)
+			hits = append(hits, hit.toSummary())
 		}
 	}
+	return filter.apply(hits)
+}
+
+func (hit SearchHit) toSummary() broadcastSummary {
+	// The search endpoint (current/search) returns v4.0-style hrefs, but
+	// getBroadcast now consumes the v5.0 broadcast/{id} endpoint. The
+	// broadcast-level hit's id is v5.0-compatible (verified against the
+	// live API), so build the v5.0 href here; item-level hits never reach
+	// this point (they are filtered by Entity == "Broadcast").
+	href := fmt.Sprintf("https://audioapi.orf.at/fm4/api/json/5.0/broadcast/%d", hit.Data.ID)
+	return broadcastSummary{
+		ID:             hit.Data.ID,
+		Href:           href,
+		Station:        hit.Data.Station,
+		ProgramKey:     hit.Data.ProgramKey,
+		Title:          hit.Data.Title,
+		Subtitle:       removeHtmlTags(trim(hit.Data.Subtitle)),
+		PressRelease:   removeHtmlTags(trim(hit.Data.PressRelease)),
+		BroadcastDay:   hit.Data.BroadcastDay,
+		Start:          hit.Data.StartISO,
+		End:            hit.Data.EndISO,
+		Duration:       hit.Data.EndISO.Sub(hit.Data.StartISO).Milliseconds(),
+		State:          hit.Data.State,
+		IsOnDemand:     hit.Data.IsOnDemand,
+		IsGeoProtected: hit.Data.IsGeoProtected,
+	}
+}
+
+func hrefs(broadcasts []broadcastSummary) []string {
+	var result []string
+	for _, b := range broadcasts {
+		result = append(result, b.Href)
+	}
 	return result
 }
 
+// sortBroadcasts orders the hits by sortBy, a key searchOptions.validate
+// accepts; "" keeps the API order.
+func sortBroadcasts(broadcasts []broadcastSummary, sortBy string, reverse bool) {
+	var less func(a, b broadcastSummary) bool
+	switch sortBy {
+	case "date":
+		less = func(a, b broadcastSummary) bool { return a.Start.Before(b.Start) }
+	case "title":
+		less = func(a, b broadcastSummary) bool { return strings.ToLower(a.Title) < strings.ToLower(b.Title) }
+	case "duration":
+		less = func(a, b broadcastSummary) bool { return a.Duration < b.Duration }
+	case "":
+		if reverse {
+			for i, j := 0, len(broadcasts)-1; i < j; i, j = i+1, j-1 {
+				broadcasts[i], broadcasts[j] = broadcasts[j], broadcasts[i]
+			}
+		}
+		return
+	}
+	sort.SliceStable(broadcasts, func(i, j int) bool {
+		if reverse {
+			return less(broadcasts[j], broadcasts[i])
+		}
+		return less(broadcasts[i], broadcasts[j])
+	})
+}
+
+// printBroadcasts writes the broadcasts to w in the given format: the
+// human-readable "text" block, an aligned "table", "json" or "csv".
+func printBroadcasts(w io.Writer, broadcasts []broadcastSummary, format string) error {
+	switch format {
+	case "", "text":
+		for _, b := range broadcasts {
+			_, _ = fmt.Fprintf(w, "\n   Name:            %s\n", b.Title)
+			_, _ = fmt.Fprintf(w, "   ProgramKey:      %s\n", b.ProgramKey)
+			_, _ = fmt.Fprintf(w, "   BroadcastDay:    %d\n", b.BroadcastDay)
+			_, _ = fmt.Fprintf(w, "   Href:            %s\n", b.Href)
+			_, _ = fmt.Fprintf(w, "   StartISO:        %s\n", b.Start)
+			_, _ = fmt.Fprintf(w, "   Weekday:         %s\n", b.Start.Weekday())
+			_, _ = fmt.Fprintf(w, "   Duration (min):  %d\n", int64(b.duration().Minutes()))
+			_, _ = fmt.Fprintf(w, "   Offset (hours):  %f\n\n", time.Since(b.Start).Hours()*-1)
+		}
+		return nil
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "#\tDAY\tSTART\tMIN\tKEY\tSTATION\tON-DEMAND\tTITLE")
+		for i, b := range broadcasts {
+			_, _ = fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%s\t%s\t%t\t%s\n",
+				i+1, b.BroadcastDay, b.Start.Format("Mon 15:04"), int64(b.duration().Minutes()),
+				b.ProgramKey, b.Station, b.IsOnDemand, b.Title)
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if broadcasts == nil {
+			broadcasts = []broadcastSummary{}
+		}
+		return enc.Encode(broadcasts)
+	case "csv":
+		cw := csv.NewWriter(w)
+		_ = cw.Write([]string{"id", "broadcastDay", "start", "end", "durationMinutes", "programKey", "station", "isOnDemand", "title", "href"})
+		for _, b := range broadcasts {
+			_ = cw.Write([]string{
+				strconv.Itoa(b.ID),
+				strconv.Itoa(b.BroadcastDay),
+				b.Start.Format(time.RFC3339),
+				b.End.Format(time.RFC3339),
+				strconv.FormatInt(int64(b.duration().Minutes()), 10),
+				b.ProgramKey,
+				b.Station,
+				strconv.FormatBool(b.IsOnDemand),
+				b.Title,
+				b.Href,
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown format %q, expected text, table, json or csv", format)
+	}
+}
+
+// parseSelection turns picker input such as "1,3-4" or "all" into zero-based
+// indexes into a list of n entries. Empty input selects nothing.
+func parseSelection(input string, n int) ([]int, error) {
+	input = trim(input)
+	if input == "" {
+		return nil, nil
+	}
+	if strings.EqualFold(input, "all") {
+		all := make([]int, n)
+		for i := range all {
+			all[i] = i
+		}
+		return all, nil
+	}
+	var selected []int
+	seen := map[int]bool{}
+	for _, part := range strings.Split(input, ",") {
+		part = trim(part)
+		from, to, isRange := strings.Cut(part, "-")
+		first, err := strconv.Atoi(trim(from))
+		if err != nil {
+			return nil, fmt.Errorf("invalid selection %q", part)
+		}
+		last := first
+		if isRange {
+			if last, err = strconv.Atoi(trim(to)); err != nil {
+				return nil, fmt.Errorf("invalid selection %q", part)
+			}
+		}
+		if first < 1 || last > n || first > last {
+			return nil, fmt.Errorf("selection %q out of range 1-%d", part, n)
+		}
+		for i := first; i <= last; i++ {
+			if !seen[i] {
+				seen[i] = true
+				selected = append(selected, i-1)
+			}
+		}
+	}
+	return selected, nil
+}
+
+// prompt asks question on stderr (keeping stdout clean for json/csv output)
+// and returns the answer line.
+func prompt(question string) string {
+	_, _ = fmt.Fprintf(os.Stderr, "   %s ", question)
+	answer, err := stdin.ReadString('\n')
+	if err != nil && err != io.EOF {
+		logError(err)
+	}
+	return trim(answer)
+}
+
+func confirm(question string) bool {
+	answer := strings.ToLower(prompt(question + " [y/N]"))
+	return answer == "y" || answer == "yes"
+}
+
+func printSuggestions(w io.Writer, searchTerm string, result SearchResult) {
+	if len(result.Hits) > 0 {
+		return
+	}
+	if len(result.Suggest) == 0 {
+		slog.Info("No search results!", "query", searchTerm)
+		return
+	}
+	_, _ = fmt.Fprintf(w, "   No results found for %s.\n\n", searchTerm)
+	_, _ = fmt.Fprintf(w, "   But did you mean ")
+	for i, s := range result.Suggest {
+		if i < len(result.Suggest)-1 {
+			_, _ = fmt.Fprintf(w, "'%s' or ", s.Text)
+		} else {
+			_, _ = fmt.Fprintf(w, "'%s'?\n\n", s.Text)
+		}
+	}
+	slog.Info("Please try again.")
+}
+
 func getSearchResults(searchTerm string) (SearchResult, error) {
+	parsedSearchResult := SearchResult{}
+
 	response, err := http.Get("https://audioapi.orf.at/fm4/api/json/current/search?q=" + url.QueryEscape(searchTerm))
+	if err != nil {
+		return parsedSearchResult, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(response.Body)
+
 	responseData, err := io.ReadAll(response.Body)
+	if err != nil {
+		return parsedSearchResult, err
+	}
 
-	parsedSearchResult := SearchResult{}
 	err = json.Unmarshal(responseData, &parsedSearchResult)
+	return parsedSearchResult, err
+}
 
-	if len(parsedSearchResult.Hits) == 0 {
-		if len(parsedSearchResult.Suggest) > 0 {
-			fmt.Printf("   No results found for %s.\n\n", searchTerm)
-			fmt.Printf("   But did you mean ")
-			for i, s := range parsedSearchResult.Suggest {
-				if i < len(parsedSearchResult.Suggest)-1 {
-					fmt.Printf("'%s' or ", s.Text)
-				} else {
-
-					fmt.Printf("'%s'?\n\n", s.Text)
-				}
-			}
-			log.Println("Please try again.")
-		} else {
-			log.Println("No search results!")
+// program is a show as identified by its stable programKey.
+type program struct {
+	ProgramKey string
+	Title      string
+}
+
+// ResolveProgramKey searches for showSearch and returns the programKey of the
+// matching show. When the hits belong to several programs, a program whose
+// title equals the query wins; otherwise the user is asked to pick one.
+// Returns "" when nothing matches.
+func ResolveProgramKey(showSearch string) string {
+
+	parsedSearchResult, err := getSearchResults(showSearch)
+	logError(err)
+	printSuggestions(os.Stdout, showSearch, parsedSearchResult)
+
+	programs, programKey := matchPrograms(showSearch, parsedSearchResult)
+	switch {
+	case programKey != "":
+		return programKey
+	case len(programs) == 0:
+		slog.Warn("No show found.", "query", showSearch)
+		return ""
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "   Several shows match '%s':\n", showSearch)
+	for i, p := range programs {
+		_, _ = fmt.Fprintf(os.Stderr, "   %d) %s (%s)\n", i+1, p.Title, p.ProgramKey)
+	}
+	answer := prompt("Which one?")
+	choice, err := strconv.Atoi(answer)
+	if err != nil || choice < 1 || choice > len(programs) {
+		fatalf("no show selected for '%s'; pass one of the programKeys above to 'url' instead", showSearch)
+	}
+	return programs[choice-1].ProgramKey
+}
+
+// lookupProgramKey resolves a show name like ResolveProgramKey, but for
+// unattended runs: it never asks and returns "" when no show or several shows
+// match.
+func lookupProgramKey(showSearch string) string {
+	result, err := getSearchResults(showSearch)
+	if err != nil {
+		slog.Warn("Could not search for the show", "query", showSearch, "error", err)
+		return ""
+	}
+	programs, programKey := matchPrograms(showSearch, result)
+	if programKey == "" {
+		slog.Warn("Cannot tell which show is meant", "query", showSearch, "matches", len(programs))
+	}
+	return programKey
+}
+
+// matchPrograms returns the programs whose broadcasts match the show name and
+// the programKey of the one meant, if that is clear: the only match or the
+// only one titled exactly like the name.
+func matchPrograms(showSearch string, result SearchResult) ([]program, string) {
+	programs := searchPrograms(searchBroadcasts(showSearch, result, broadcastFilter{}))
+	if len(programs) == 1 {
+		return programs, programs[0].ProgramKey
+	}
+	var exact []program
+	for _, p := range programs {
+		if strings.EqualFold(trim(p.Title), trim(showSearch)) {
+			exact = append(exact, p)
 		}
 	}
-	return parsedSearchResult, err
+	if len(exact) == 1 {
+		return programs, exact[0].ProgramKey
+	}
+	return programs, ""
+}
+
+// searchPrograms collapses broadcast hits into the distinct programs they
+// belong to, in order of first appearance.
+func searchPrograms(hits []broadcastSummary) []program {
+	var programs []program
+	seen := map[string]bool{}
+	for _, hit := range hits {
+		if hit.ProgramKey == "" || seen[hit.ProgramKey] {
+			continue
+		}
+		seen[hit.ProgramKey] = true
+		programs = append(programs, program{ProgramKey: hit.ProgramKey, Title: hit.Title})
+	}
+	return programs
 }
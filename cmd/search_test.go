@@ -1,36 +1,17 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"github.com/jarcoal/httpmock"
 	"net/http"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
-func TestSearchBroadcastUrl(t *testing.T) {
-	httpmock.Activate()
-	defer httpmock.DeactivateAndReset()
-
-	searchUrl := "https://audioapi.orf.at/fm4/api/json/current/search?q=Swound+Sound"
-
-	httpmock.RegisterResponder("GET", searchUrl,
-		func(req *http.Request) (*http.Response, error) {
-			resp, err := httpmock.NewJsonResponse(200, httpmock.File("../_testdata/searchresult.json"))
-			if err != nil {
-				return httpmock.NewStringResponse(500, ""), nil
-			}
-			return resp, nil
-		},
-	)
-
-	got := SearchBroadcastUrls("Swound Sound")
-	want := []string{"https://audioapi.orf.at/fm4/api/json/5.0/broadcast/25255"}
-
-	if !reflect.DeepEqual(got, want) {
-		t.Errorf("got %q want %q", got, want)
-	}
-}
-
 func TestGetSearchResults(t *testing.T) {
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
@@ -106,3 +87,228 @@ func TestGetNoSearchResults(t *testing.T) {
 		t.Errorf("Wrong amount of search results. got %s want %s", got.Suggest[0].Text, "zimmerservice")
 	}
 }
+
+func registerSearchResponder(query string, file string) {
+	httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/current/search?q="+query,
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File(file))
+		},
+	)
+}
+
+func TestSearchBroadcastsFilter(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	registerSearchResponder("s", "../_testdata/searchresult.json")
+
+	result, err := getSearchResults("s")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both Sleepless (4SL, Sun 03:01, ~3h) and Swound Sound (4SS, Sat 22:01, ~2h)
+	// contain an "s".
+	cases := []struct {
+		name   string
+		filter broadcastFilter
+		want   []int
+	}{
+		{"no filter", broadcastFilter{}, []int{25257, 25255}},
+		{"programKey", broadcastFilter{ProgramKey: "4ss"}, []int{25255}},
+		{"weekday", broadcastFilter{Weekdays: []time.Weekday{time.Sunday}}, []int{25257}},
+		{"min duration", broadcastFilter{MinDuration: 150 * time.Minute}, []int{25257}},
+		{"until", broadcastFilter{Until: 20220805}, nil},
+		{"station", broadcastFilter{Station: "oe1"}, nil},
+	}
+	for _, c := range cases {
+		var got []int
+		for _, b := range searchBroadcasts("s", result, c.filter) {
+			got = append(got, b.ID)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSortBroadcasts(t *testing.T) {
+	broadcasts := []broadcastSummary{
+		{ID: 1, Title: "b", Duration: 2},
+		{ID: 2, Title: "C", Duration: 3},
+		{ID: 3, Title: "a", Duration: 1},
+	}
+
+	sortBroadcasts(broadcasts, "title", false)
+	if got := []int{broadcasts[0].ID, broadcasts[1].ID, broadcasts[2].ID}; !reflect.DeepEqual(got, []int{3, 1, 2}) {
+		t.Errorf("title: got %v", got)
+	}
+	sortBroadcasts(broadcasts, "duration", true)
+	if got := []int{broadcasts[0].ID, broadcasts[1].ID, broadcasts[2].ID}; !reflect.DeepEqual(got, []int{2, 1, 3}) {
+		t.Errorf("duration reversed: got %v", got)
+	}
+}
+
+func TestPrintBroadcastsFormats(t *testing.T) {
+	broadcasts := []broadcastSummary{{
+		ID:           25255,
+		Title:        "Swound Sound",
+		ProgramKey:   "4SS",
+		Station:      "fm4",
+		BroadcastDay: 20220806,
+		Start:        time.Date(2022, 8, 6, 22, 0, 0, 0, time.UTC),
+		End:          time.Date(2022, 8, 7, 0, 0, 0, 0, time.UTC),
+		Duration:     7200000,
+		IsOnDemand:   true,
+	}}
+
+	var jsonOut bytes.Buffer
+	if err := printBroadcasts(&jsonOut, broadcasts, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []broadcastSummary
+	if err := json.Unmarshal(jsonOut.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != 1 || decoded[0].ProgramKey != "4SS" {
+		t.Errorf("json round trip got %+v", decoded)
+	}
+
+	var csvOut bytes.Buffer
+	if err := printBroadcasts(&csvOut, broadcasts, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(trim(csvOut.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "25255,20220806,") {
+		t.Errorf("csv got %q", csvOut.String())
+	}
+
+	if err := printBroadcasts(&bytes.Buffer{}, broadcasts, "yaml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestParseSelection(t *testing.T) {
+	cases := []struct {
+		input string
+		want  []int
+		err   bool
+	}{
+		{"", nil, false},
+		{"all", []int{0, 1, 2, 3}, false},
+		{"1,3-4", []int{0, 2, 3}, false},
+		{"2, 2", []int{1}, false},
+		{"5", nil, true},
+		{"x", nil, true},
+	}
+	for _, c := range cases {
+		got, err := parseSelection(c.input, 4)
+		if (err != nil) != c.err {
+			t.Errorf("%q: err=%v want error %v", c.input, err, c.err)
+			continue
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: got %v want %v", c.input, got, c.want)
+		}
+	}
+}
+
+func TestSearchRerunsWithSuggestion(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	registerSearchResponder("Swund+Sound", "../_testdata/no_searchresult.json")
+	registerSearchResponder("zimmerservice", "../_testdata/searchresult.json")
+
+	defer func(r *bufio.Reader) { stdin = r }(stdin)
+	defer func(f func() bool) { stdinIsTerminal = f }(stdinIsTerminal)
+	stdinIsTerminal = func() bool { return true }
+
+	// Machine-readable output is never interrupted by the prompt.
+	stdin = bufio.NewReader(strings.NewReader("y\n"))
+	Search("Swund Sound", searchOptions{format: "json"})
+	suggestionUrl := "GET https://audioapi.orf.at/fm4/api/json/current/search?q=zimmerservice"
+	if n := httpmock.GetCallCountInfo()[suggestionUrl]; n != 0 {
+		t.Errorf("expected no prompt for json output, got %d reruns", n)
+	}
+
+	Search("Swund Sound", searchOptions{format: "table"})
+	if n := httpmock.GetCallCountInfo()[suggestionUrl]; n != 1 {
+		t.Errorf("expected a rerun with the top suggestion, got %d", n)
+	}
+
+	// Nor is a run without a terminal to answer.
+	stdinIsTerminal = func() bool { return false }
+	stdin = bufio.NewReader(strings.NewReader("y\n"))
+	Search("Swund Sound", searchOptions{format: "table"})
+	if n := httpmock.GetCallCountInfo()[suggestionUrl]; n != 1 {
+		t.Errorf("expected no prompt without a terminal, got %d reruns", n)
+	}
+}
+
+func TestSearchOptionsValidate(t *testing.T) {
+	for _, opts := range []searchOptions{{sortBy: "size"}, {format: "xml"}} {
+		if err := opts.validate(); err == nil {
+			t.Errorf("expected %+v to be rejected", opts)
+		}
+	}
+	if err := (searchOptions{sortBy: "date", format: "csv"}).validate(); err != nil {
+		t.Errorf("expected valid options, got %v", err)
+	}
+}
+
+func TestResolveProgramKey(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	registerSearchResponder("Swound+Sound", "../_testdata/searchresult.json")
+
+	if got := ResolveProgramKey("Swound Sound"); got != "4SS" {
+		t.Errorf("got %q want %q", got, "4SS")
+	}
+}
+
+func TestResolveProgramKeyExactTitleWins(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	registerSearchResponder("swound+sound", "../_testdata/searchresult_swound_sound.json")
+
+	// Would pick Swound Sound Spezial (4SX), listed first, if asked.
+	defer func(r *bufio.Reader) { stdin = r }(stdin)
+	stdin = bufio.NewReader(strings.NewReader("1\n"))
+
+	if got := ResolveProgramKey("swound sound"); got != "4SS" {
+		t.Errorf("got %q want %q", got, "4SS")
+	}
+}
+
+func TestResolveProgramKeyAsksWhenAmbiguous(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	registerSearchResponder("s", "../_testdata/searchresult.json")
+
+	defer func(r *bufio.Reader) { stdin = r }(stdin)
+	stdin = bufio.NewReader(strings.NewReader("2\n"))
+
+	// Sleepless (4SL) is listed first, Swound Sound (4SS) second.
+	if got := ResolveProgramKey("s"); got != "4SS" {
+		t.Errorf("got %q want %q", got, "4SS")
+	}
+}
+
+func TestLookupProgramKeyNeverAsks(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	registerSearchResponder("s", "../_testdata/searchresult.json")
+	registerSearchResponder("swound+sound", "../_testdata/searchresult_swound_sound.json")
+
+	defer func(r *bufio.Reader) { stdin = r }(stdin)
+	stdin = bufio.NewReader(strings.NewReader("2\n"))
+
+	if got := lookupProgramKey("s"); got != "" {
+		t.Errorf("got %q for an ambiguous name, want none", got)
+	}
+	if got := lookupProgramKey("swound sound"); got != "4SS" {
+		t.Errorf("got %q want %q", got, "4SS")
+	}
+	if answer, _ := stdin.ReadString('\n'); answer != "2\n" {
+		t.Errorf("expected the answer to be left unread, got %q", answer)
+	}
+}
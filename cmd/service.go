@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+// errRunAborted is raised instead of exiting when fatal is hit inside runOnce.
+var errRunAborted = errors.New("run aborted")
+
+// abortingRuns is set while runOnce runs, making fatal abort the run instead
+// of exiting.
+var abortingRuns atomic.Bool
+
+// runEvery calls run every interval, forever. This is the long-running mode of
+// download and url (-every): a fatal error aborts only the current run, so a
+// flaky API does not take the service down.
+func runEvery(interval time.Duration, run func()) {
+	for {
+		if !runOnce(run) {
+			slog.Error("Run aborted, retrying at the next interval", "interval", interval.String())
+		}
+		slog.Info("Waiting for the next run", "next", time.Now().Add(interval).Format(YYYYMMDD+" "+HHMMSS24h))
+		time.Sleep(interval)
+	}
+}
+
+// runOnce calls run and reports whether it completed. Calls to fatal within
+// run unwind back here instead of exiting the process.
+func runOnce(run func()) (ok bool) {
+	defer func(previous bool) {
+		abortingRuns.Store(previous)
+		if r := recover(); r != nil {
+			if r != errRunAborted {
+				panic(r)
+			}
+			ok = false
+		}
+	}(abortingRuns.Swap(true))
+
+	run()
+	return true
+}
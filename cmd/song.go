@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// songHit is an item-level search hit, a song or segment, located in the
+// broadcast it was played in.
+type songHit struct {
+	Interpreter string    `json:"interpreter,omitempty"`
+	Title       string    `json:"title"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+	// Offset is where the song starts in the broadcast, in milliseconds.
+	Offset         int64  `json:"offset"`
+	BroadcastTitle string `json:"broadcastTitle"`
+	BroadcastDay   int    `json:"broadcastDay"`
+	ProgramKey     string `json:"programKey"`
+	Href           string `json:"href"` // of the broadcast
+	IsOnDemand     bool   `json:"isOnDemand"`
+}
+
+func (s songHit) name() string {
+	if s.Interpreter == "" {
+		return s.Title
+	}
+	return s.Interpreter + " - " + s.Title
+}
+
+func (s songHit) clip() clip {
+	return clip{start: s.Start, end: s.End, title: s.Title, artist: s.Interpreter}
+}
+
+// findSongOptions are the knobs of the 'find-song' subcommand.
+type findSongOptions struct {
+	format      string // table or json
+	download    bool
+	interactive bool
+	outDir      string
+}
+
+// FindSong lists the broadcasts and times a song matching the query was
+// played at and optionally downloads the songs as clips: all of them with
+// opts.download, or the ones picked by the user in interactive mode.
+func FindSong(query string, opts findSongOptions) {
+	result, err := getSearchResults(query)
+	logError(err)
+	songs := findSongs(query, result)
+	if len(songs) == 0 {
+		slog.Info("No songs found", "query", query)
+	}
+
+	format := opts.format
+	if opts.interactive {
+		format = "table"
+	}
+	logError(printSongs(os.Stdout, songs, format))
+
+	var picked []songHit
+	switch {
+	case opts.interactive && len(songs) > 0:
+		selected, err := parseSelection(prompt("Select songs to download (e.g. 1,3-4 or all, empty to cancel):"), len(songs))
+		logError(err)
+		for _, i := range selected {
+			picked = append(picked, songs[i])
+		}
+	case opts.download:
+		picked = songs
+	}
+	for _, song := range picked {
+		if !song.IsOnDemand {
+			slog.Warn("Broadcast not available on demand, skipping the song", "song", song.name(), "broadcast", song.BroadcastTitle)
+			continue
+		}
+		if _, err := downloadClip(getBroadcast(song.Href), song.clip(), opts.outDir); err != nil {
+			slog.Warn("Could not download the song", "song", song.name(), "error", err)
+		}
+	}
+}
+
+// findSongs returns the item-level hits with every word of the query in their
+// interpreter or title, oldest first. The hits do not name their broadcast, so
+// it is looked up in the schedule of their broadcast day.
+func findSongs(query string, result SearchResult) []songHit {
+	words := strings.Fields(strings.ToLower(query))
+	schedules := map[int][]Broadcast{}
+	var songs []songHit
+	for _, hit := range result.Hits {
+		d := hit.Data
+		if d.Entity == "Broadcast" || !containsWords(strings.ToLower(d.Interpreter+" "+d.Title), words) {
+			continue
+		}
+		if _, ok := schedules[d.BroadcastDay]; !ok {
+			station := d.Station
+			if station == "" {
+				station = "fm4"
+			}
+			schedules[d.BroadcastDay] = getDaySchedule(station, d.BroadcastDay)
+		}
+		broadcast, ok := playedIn(schedules[d.BroadcastDay], d.ProgramKey, d.StartISO)
+		if !ok {
+			slog.Warn("Cannot find the broadcast the song was played in", "title", d.Title, "start", d.StartISO)
+			continue
+		}
+		songs = append(songs, songHit{
+			Interpreter:    trim(d.Interpreter),
+			Title:          trim(d.Title),
+			Start:          d.StartISO,
+			End:            d.EndISO,
+			Offset:         d.StartISO.Sub(broadcast.StartISO).Milliseconds(),
+			BroadcastTitle: trim(broadcast.Title),
+			BroadcastDay:   broadcast.BroadcastDay,
+			ProgramKey:     broadcast.ProgramKey,
+			Href:           broadcast.Href,
+			IsOnDemand:     broadcast.IsOnDemand,
+		})
+	}
+	sort.SliceStable(songs, func(i, j int) bool { return songs[i].Start.Before(songs[j].Start) })
+	return songs
+}
+
+func containsWords(text string, words []string) bool {
+	for _, w := range words {
+		if !strings.Contains(text, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// playedIn returns the broadcast of the schedule running at start, of the
+// programKey if the hit has one.
+func playedIn(schedule []Broadcast, programKey string, start time.Time) (Broadcast, bool) {
+	for _, b := range schedule {
+		if (programKey == "" || b.ProgramKey == programKey) && !start.Before(b.StartISO) && start.Before(b.EndISO) {
+			return b, true
+		}
+	}
+	return Broadcast{}, false
+}
+
+func printSongs(w io.Writer, songs []songHit, format string) error {
+	switch format {
+	case "", "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "#\tDAY\tTIME\tAT\tKEY\tON-DEMAND\tBROADCAST\tSONG")
+		for i, s := range songs {
+			_, _ = fmt.Fprintf(tw, "%d\t%d\t%s\t%s\t%s\t%t\t%s\t%s\n",
+				i+1, s.BroadcastDay, s.Start.Local().Format("Mon 15:04"), formatMs(s.Offset),
+				s.ProgramKey, s.IsOnDemand, s.BroadcastTitle, s.name())
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if songs == nil {
+			songs = []songHit{}
+		}
+		return enc.Encode(songs)
+	default:
+		return fmt.Errorf("unknown format %q, expected table or json", format)
+	}
+}
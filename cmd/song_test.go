@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bogem/id3v2"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestFindSong(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/current/search?q=bilderbuch+maschin",
+		httpmock.NewStringResponder(200, `{"total": 4, "hits": [
+			{"data": {"entity": "Broadcast", "id": 42628, "station": "fm4", "programKey": "4DD", "title": "Davidecks",
+			 "broadcastDay": 20260620, "subtitle": "Bilderbuch Maschin Special"}},
+			{"data": {"entity": "BroadcastItem", "station": "fm4", "programKey": "4DD", "broadcastDay": 20260620,
+			 "interpreter": "Bilderbuch", "title": "Maschin",
+			 "startISO": "2026-06-20T19:10:00+02:00", "endISO": "2026-06-20T19:14:00+02:00"}},
+			{"data": {"entity": "BroadcastItem", "station": "fm4", "programKey": "4DD", "broadcastDay": 20260620,
+			 "interpreter": "Bilderbuch", "title": "Bungalow",
+			 "startISO": "2026-06-20T19:20:00+02:00", "endISO": "2026-06-20T19:24:00+02:00"}},
+			{"data": {"entity": "BroadcastItem", "station": "fm4", "programKey": "4DD", "broadcastDay": 20260620,
+			 "interpreter": "Bilderbuch", "title": "Maschin (Live)",
+			 "startISO": "2026-06-20T23:10:00+02:00", "endISO": "2026-06-20T23:14:00+02:00"}}
+		]}`))
+	httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/5.0/broadcasts/20260620",
+		httpmock.NewStringResponder(200, `{"payload": [
+			{"href": "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628", "station": "fm4", "id": 42628,
+			 "broadcastDay": 20260620, "programKey": "4DD", "title": "Davidecks", "isOnDemand": true,
+			 "start": "2026-06-20T16:59:36.000Z", "end": "2026-06-20T18:59:39.000Z"}
+		]}`))
+	httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628?items=1000",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/broadcast_42628_full_v5.json"))
+		})
+	var requested []string
+	httpmock.RegisterRegexpResponder("GET", regexp.MustCompile(`^https://loopstreamfm4\.apa\.at`),
+		func(req *http.Request) (*http.Response, error) {
+			requested = append(requested, req.URL.RawQuery)
+			return httpmock.NewBytesResponse(200, httpmock.File("../_testdata/show.mp3").Bytes()), nil
+		})
+
+	songs := findSongs("bilderbuch maschin", mustSearch(t, "bilderbuch maschin"))
+	if len(songs) != 1 || songs[0].BroadcastTitle != "Davidecks" || songs[0].Offset != 624000 {
+		t.Fatalf("expected Maschin 10:24 into Davidecks, got %+v", songs)
+	}
+
+	outDir := t.TempDir()
+	FindSong("bilderbuch maschin", findSongOptions{format: "json", download: true, outDir: outDir})
+	if len(requested) != 1 || !regexp.MustCompile(`&offset=624000&offsetende=864000$`).MatchString(requested[0]) {
+		t.Fatalf("expected the song's range to be requested, got %q", requested)
+	}
+	start, _ := time.Parse(time.RFC3339, "2026-06-20T19:10:00+02:00")
+	name := "Davidecks_20260620_" + start.Local().Format("150405") + "_Maschin.mp3"
+	tag, err := id3v2.Open(path.Join(outDir, name), id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tag.Close()
+	if tag.Title() != "Maschin" || tag.Artist() != "Bilderbuch" || tag.Album() != "Davidecks - 20260620" {
+		t.Errorf("unexpected tags %q, %q, %q", tag.Title(), tag.Artist(), tag.Album())
+	}
+}
+
+func mustSearch(t *testing.T, query string) SearchResult {
+	t.Helper()
+	result, err := getSearchResults(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
@@ -1,28 +1,88 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"github.com/bogem/id3v2"
 	"io/ioutil"
-	"log"
+	"log/slog"
 )
 
+// id3Values are the text frames writeId3Tag sets for a show.
+type id3Values struct {
+	Title       string `json:"title"`
+	Album       string `json:"album"`
+	Artist      string `json:"artist"`
+	AlbumArtist string `json:"albumArtist"`
+	Year        string `json:"year"`
+}
+
+func getId3Values(show Show) id3Values {
+	return id3Values{
+		Title:       fmt.Sprintf("%s - %s", show.Title, show.BroadcastDay),
+		Album:       show.Year,
+		Artist:      show.Title,
+		AlbumArtist: show.Title,
+		Year:        show.Year,
+	}
+}
+
+// userDefinedTexts returns the values of the TXXX frames by description.
+func userDefinedTexts(tag *id3v2.Tag) map[string]string {
+	values := map[string]string{}
+	for _, f := range tag.GetFrames("TXXX") {
+		if udtf, ok := f.(id3v2.UserDefinedTextFrame); ok {
+			values[udtf.Description] = udtf.Value
+		}
+	}
+	return values
+}
+
+// id3TagUpToDate reports whether the mp3 already carries the tags writeId3Tag
+// would write, so archived episodes are not rewritten on every run.
+func id3TagUpToDate(mp3path string, imagePath string, show Show) bool {
+	tag, err := id3v2.Open(mp3path, id3v2.Options{Parse: true})
+	if err != nil {
+		return false
+	}
+	defer tag.Close()
+
+	values := getId3Values(show)
+	if tag.Title() != values.Title || tag.Album() != values.Album || tag.Artist() != values.Artist ||
+		tag.Year() != values.Year || tag.GetTextFrame(tag.CommonID("TPE2")).Text != values.AlbumArtist {
+		return false
+	}
+	if imagePath != "" && len(tag.GetFrames(tag.CommonID("Attached picture"))) == 0 {
+		return false
+	}
+	if items := contentItems(show.Items); len(items) > 0 {
+		value, _ := json.Marshal(items)
+		if userDefinedTexts(tag)[contentItemsFrame] != string(value) {
+			return false
+		}
+	}
+	return true
+}
+
 func writeId3Tag(mp3path string, imagePath string, show Show) {
 
-	tag, err := id3v2.Open(mp3path, id3v2.Options{Parse: false})
+	// Parse the existing tag so frames written by later stages, such as the
+	// ReplayGain values, survive re-tagging.
+	tag, err := id3v2.Open(mp3path, id3v2.Options{Parse: true})
 	if err != nil {
-		log.Fatal("Error while opening mp3 file: ", err)
+		fatal("Error while opening mp3 file", "path", mp3path, "error", err)
 	}
 
-	tag.SetTitle(fmt.Sprintf("%s - %s", show.Title, show.BroadcastDay))
-	tag.SetAlbum(show.Year)
-	tag.SetArtist(show.Title)
-	tag.SetYear(show.Year)
+	values := getId3Values(show)
+	tag.SetTitle(values.Title)
+	tag.SetAlbum(values.Album)
+	tag.SetArtist(values.Artist)
+	tag.SetYear(values.Year)
 
 	if imagePath != "" {
 		artwork, err := ioutil.ReadFile(imagePath)
 		if err != nil {
-			log.Println("Error while reading artwork file", err)
+			slog.Warn("Error while reading artwork file", "path", imagePath, "error", err)
 		}
 
 		pic := id3v2.PictureFrame{
@@ -34,24 +94,57 @@ func writeId3Tag(mp3path string, imagePath string, show Show) {
 		}
 		tag.AddAttachedPicture(pic)
 
-		log.Println("Attached cover.")
+		slog.Debug("Attached cover.", "path", imagePath)
 	} else {
-		log.Println("No cover url provided. Skipped image tag.")
+		slog.Info("No cover url provided. Skipped image tag.")
+	}
+
+	if items := contentItems(show.Items); len(items) > 0 {
+		value, _ := json.Marshal(items)
+		tag.AddUserDefinedTextFrame(id3v2.UserDefinedTextFrame{
+			Encoding:    id3v2.EncodingUTF8,
+			Description: contentItemsFrame,
+			Value:       string(value),
+		})
 	}
 
 	textFrame := id3v2.TextFrame{
 		Encoding: id3v2.EncodingUTF8,
-		Text:     show.Title,
+		Text:     values.AlbumArtist,
 	}
 	tag.AddFrame(tag.CommonID("TPE2"), textFrame)
 
 	defer func(tag *id3v2.Tag) {
 		err := tag.Close()
 		if err != nil {
-			log.Fatal(err)
+			logError(err)
 		}
 	}(tag)
 
 	err = tag.Save()
 	logError(err)
 }
+
+// writeClipTag tags a clip cut from a broadcast. Unlike writeId3Tag it has no
+// cover and no content items to carry.
+func writeClipTag(mp3path string, values id3Values) {
+	tag, err := id3v2.Open(mp3path, id3v2.Options{Parse: true})
+	if err != nil {
+		fatal("Error while opening mp3 file", "path", mp3path, "error", err)
+	}
+	defer func(tag *id3v2.Tag) {
+		err := tag.Close()
+		if err != nil {
+			logError(err)
+		}
+	}(tag)
+
+	tag.SetTitle(values.Title)
+	tag.SetAlbum(values.Album)
+	tag.SetArtist(values.Artist)
+	tag.SetYear(values.Year)
+	tag.AddFrame(tag.CommonID("TPE2"), id3v2.TextFrame{Encoding: id3v2.EncodingUTF8, Text: values.AlbumArtist})
+
+	err = tag.Save()
+	logError(err)
+}
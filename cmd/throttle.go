@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// throttle holds the politeness settings shared by every download and API
+// call of the process, so concurrent downloads split one budget.
+type throttle struct {
+	mu sync.Mutex
+
+	// rate caps the download bandwidth in bytes per second; 0 is unlimited.
+	rate int64
+	// nextRead is when the bandwidth budget allows the next read.
+	nextRead time.Time
+
+	// requestDelay is the minimum time between two outgoing requests.
+	requestDelay time.Duration
+	// nextRequest is when the next request may be sent.
+	nextRequest time.Time
+
+	// windows are the times of day downloads may run in; none means always.
+	windows []timeWindow
+}
+
+var politeness = &throttle{}
+
+// sleep waits; tests replace it to observe the waits without spending them.
+var sleep = time.Sleep
+
+// configureThrottle applies the politeness options of a run.
+func configureThrottle(opts downloadOptions) {
+	politeness.mu.Lock()
+	defer politeness.mu.Unlock()
+	politeness.rate = opts.maxRate
+	politeness.requestDelay = opts.requestDelay
+	politeness.windows = opts.windows
+}
+
+// reserveRead books n bytes of the bandwidth budget and returns how long the
+// caller has to wait before they are used up.
+func (t *throttle) reserveRead(n int) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rate <= 0 || n <= 0 {
+		return 0
+	}
+	current := now()
+	if t.nextRead.Before(current) {
+		t.nextRead = current
+	}
+	wait := t.nextRead.Sub(current)
+	t.nextRead = t.nextRead.Add(time.Duration(int64(n) * int64(time.Second) / t.rate))
+	return wait
+}
+
+// chunkSize is the largest read that keeps the rate smooth: a quarter second
+// worth of bandwidth. 0 means unlimited.
+func (t *throttle) chunkSize() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.rate <= 0 {
+		return 0
+	}
+	return int(t.rate/4 + 1)
+}
+
+// reserveRequest books the next request slot and returns how long the caller
+// has to wait for it.
+func (t *throttle) reserveRequest() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.requestDelay <= 0 {
+		return 0
+	}
+	current := now()
+	if t.nextRequest.Before(current) {
+		t.nextRequest = current
+	}
+	wait := t.nextRequest.Sub(current)
+	t.nextRequest = t.nextRequest.Add(t.requestDelay)
+	return wait
+}
+
+// untilWindow returns how long to wait until downloads are allowed at the
+// given time.
+func (t *throttle) untilWindow(at time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.windows) == 0 {
+		return 0
+	}
+	minutes := at.Hour()*60 + at.Minute()
+	var wait time.Duration = -1
+	for _, w := range t.windows {
+		if w.contains(minutes) {
+			return 0
+		}
+		until := w.start - minutes
+		if until < 0 {
+			until += 24 * 60
+		}
+		d := time.Duration(until)*time.Minute - time.Duration(at.Second())*time.Second
+		if wait < 0 || d < wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// waitForWindow blocks until downloads are allowed.
+func waitForWindow() {
+	if wait := politeness.untilWindow(now()); wait > 0 {
+		slog.Info("Outside the download window, waiting", "until", now().Add(wait).Format(HHMMSS24h))
+		sleep(wait)
+	}
+}
+
+// throttledReader is an io.Reader that stays within the shared bandwidth cap.
+type throttledReader struct {
+	r io.Reader
+}
+
+func (r throttledReader) Read(p []byte) (int, error) {
+	// Keep the chunks small so the rate stays smooth at low caps.
+	if limit := politeness.chunkSize(); limit > 0 && len(p) > limit {
+		p = p[:limit]
+	}
+	n, err := r.r.Read(p)
+	if wait := politeness.reserveRead(n); wait > 0 {
+		sleep(wait)
+	}
+	return n, err
+}
+
+// politeTransport spaces out outgoing requests by the configured delay.
+type politeTransport struct {
+	next http.RoundTripper
+}
+
+func (t politeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if wait := politeness.reserveRequest(); wait > 0 {
+		sleep(wait)
+	}
+	return t.next.RoundTrip(req)
+}
+
+// timeWindow is a time of day range in minutes after midnight. A window whose
+// end is before its start spans midnight.
+type timeWindow struct {
+	start, end int
+}
+
+func (w timeWindow) contains(minutes int) bool {
+	if w.start <= w.end {
+		return minutes >= w.start && minutes < w.end
+	}
+	return minutes >= w.start || minutes < w.end
+}
+
+var windowPattern = regexp.MustCompile(`^(\d{1,2}):(\d{2})-(\d{1,2}):(\d{2})$`)
+
+// parseWindows parses comma separated HH:MM-HH:MM time of day windows, e.g.
+// "01:00-07:00,22:30-23:59".
+func parseWindows(value string) ([]timeWindow, error) {
+	var windows []timeWindow
+	for _, part := range strings.Split(value, ",") {
+		part = trim(part)
+		if part == "" {
+			continue
+		}
+		m := windowPattern.FindStringSubmatch(part)
+		if m == nil {
+			return nil, fmt.Errorf("expected a time window as HH:MM-HH:MM, got %q", part)
+		}
+		var n [4]int
+		for i := range n {
+			n[i], _ = strconv.Atoi(m[i+1])
+		}
+		// A window may end at 24:00, midnight at the end of the day.
+		if n[0] > 23 || n[2] > 24 || n[1] > 59 || n[3] > 59 || n[2] == 24 && n[3] != 0 {
+			return nil, fmt.Errorf("invalid time in window %q", part)
+		}
+		windows = append(windows, timeWindow{start: n[0]*60 + n[1], end: n[2]*60 + n[3]})
+	}
+	return windows, nil
+}
+
+var ratePattern = regexp.MustCompile(`^(\d+(?:\.\d+)?)\s*([kKmMgG]?)(i?)[bB]?(?:/s)?$`)
+
+// parseRate parses a bandwidth such as "2MB/s", "500KB/s", "1.5MiB/s" or a
+// plain number of bytes per second. Empty or "0" means unlimited.
+func parseRate(value string) (int64, error) {
+	value = trim(value)
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	m := ratePattern.FindStringSubmatch(value)
+	if m == nil {
+		return 0, fmt.Errorf("expected a rate like 2MB/s, got %q", value)
+	}
+	amount, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	base := 1000.0
+	if m[3] == "i" {
+		base = 1024
+	}
+	switch strings.ToLower(m[2]) {
+	case "k":
+		amount *= base
+	case "m":
+		amount *= base * base
+	case "g":
+		amount *= base * base * base
+	}
+	return int64(amount), nil
+}
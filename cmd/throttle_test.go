@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	cases := map[string]int64{
+		"":         0,
+		"0":        0,
+		"2MB/s":    2000000,
+		"500KB/s":  500000,
+		"1MiB/s":   1048576,
+		"1.5mb":    1500000,
+		"123456":   123456,
+		"64 KiB/s": 65536,
+	}
+	for in, want := range cases {
+		got, err := parseRate(in)
+		if err != nil || got != want {
+			t.Errorf("parseRate(%q) got %d, %v want %d", in, got, err, want)
+		}
+	}
+	if _, err := parseRate("fast"); err == nil {
+		t.Error("expected an error for an invalid rate")
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	got, err := parseWindows("01:00-07:00, 22:30-02:15, 20:00-24:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []timeWindow{{60, 420}, {1350, 135}, {1200, 1440}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v want %v", got, want)
+	}
+	for _, invalid := range []string{"25:00-26:00", "22:00-24:59", "24:00-02:00"} {
+		if _, err := parseWindows(invalid); err == nil {
+			t.Errorf("expected an error for the invalid time %q", invalid)
+		}
+	}
+}
+
+func TestUntilWindow(t *testing.T) {
+	th := &throttle{windows: []timeWindow{{60, 420}, {1350, 135}}} // 01:00-07:00, 22:30-02:15
+	at := func(h, m int) time.Time { return time.Date(2026, 7, 1, h, m, 0, 0, time.UTC) }
+
+	cases := []struct {
+		at   time.Time
+		want time.Duration
+	}{
+		{at(3, 0), 0},  // inside the first window
+		{at(23, 0), 0}, // inside the window spanning midnight
+		{at(1, 30), 0}, // inside both
+		{at(12, 0), 10*time.Hour + 30*time.Minute}, // until 22:30
+		{at(7, 0), 15*time.Hour + 30*time.Minute},  // the end is exclusive
+	}
+	for _, c := range cases {
+		if got := th.untilWindow(c.at); got != c.want {
+			t.Errorf("at %s got %s want %s", c.at.Format("15:04"), got, c.want)
+		}
+	}
+
+	if got := (&throttle{}).untilWindow(at(12, 0)); got != 0 {
+		t.Errorf("without windows got %s want 0", got)
+	}
+}
+
+func TestThrottledReader(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	clock := time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	var slept time.Duration
+	defer func(f func(time.Duration)) { sleep = f }(sleep)
+	sleep = func(d time.Duration) {
+		slept += d
+		clock = clock.Add(d)
+	}
+
+	defer configureThrottle(downloadOptions{})
+	configureThrottle(downloadOptions{maxRate: 1000})
+
+	data := bytes.Repeat([]byte{1}, 3000)
+	got, err := io.ReadAll(throttledReader{bytes.NewReader(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(data) {
+		t.Fatalf("read %d bytes want %d", len(got), len(data))
+	}
+	// 3000 bytes at 1000 B/s: the last read may still be pending when the
+	// reader returns, so at least 2s must have been waited.
+	if slept < 2*time.Second || slept > 3*time.Second {
+		t.Errorf("slept %s, want between 2s and 3s", slept)
+	}
+}
+
+func TestReserveRequest(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	clock := time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return clock }
+
+	th := &throttle{requestDelay: 500 * time.Millisecond}
+	waits := []time.Duration{th.reserveRequest(), th.reserveRequest(), th.reserveRequest()}
+	want := []time.Duration{0, 500 * time.Millisecond, time.Second}
+	if !reflect.DeepEqual(waits, want) {
+		t.Errorf("got %v want %v", waits, want)
+	}
+}
@@ -0,0 +1,11 @@
+package main
+
+import "net/http"
+
+// setupHttpClient installs the transport chain of the default client, which
+// every request goes through (the audioapi calls, loopstream and the cover
+// images): the audioapi calls are answered from the response cache when
+// possible, the rest is spaced out and measured.
+func setupHttpClient() {
+	http.DefaultClient.Transport = cacheTransport{next: politeTransport{next: metricsTransport{}}}
+}
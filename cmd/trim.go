@@ -7,6 +7,25 @@ import "sort"
 // audio between tagged items) is kept.
 var removeTypes = map[string]bool{"N": true, "W": true}
 
+// itemTypeNames describes the broadcast item types seen in the ORF metadata.
+var itemTypeNames = map[string]string{
+	"N": "news",
+	"W": "weather/ad spot",
+	"B": "show content",
+}
+
+// cutReason explains why an item of the given type is cut from a download, or
+// returns "" when it is kept.
+func cutReason(itemType string) string {
+	if !removeTypes[itemType] {
+		return ""
+	}
+	if name, ok := itemTypeNames[itemType]; ok {
+		return "type " + itemType + " (" + name + ")"
+	}
+	return "type " + itemType
+}
+
 // segment is a slice of a stream expressed as millisecond offsets relative to
 // streams[0].start, ready to be passed to the loopstream offset/offsetende
 // query params.
@@ -15,6 +34,12 @@ type segment struct {
 	offsetEnd int64
 }
 
+// cut is an interval of a broadcast to remove, in absolute milliseconds like
+// the item and stream timestamps.
+type cut struct {
+	start, end int64
+}
+
 // contentSegments returns the ranges to download with the news and ad/weather
 // spots removed. It starts from the full stream and cuts out the intervals of
 // the removed item types, keeping everything in between (tagged items are
@@ -22,6 +47,23 @@ type segment struct {
 // Returns nil when there is no stream or nothing to cut, signalling a plain
 // full-stream download (unchanged legacy behaviour).
 func contentSegments(show Show) []segment {
+	return keepSegments(show, itemCuts(show))
+}
+
+// itemCuts returns the intervals of the removed item types.
+func itemCuts(show Show) []cut {
+	var cuts []cut
+	for _, item := range show.Items {
+		if removeTypes[item.Type] {
+			cuts = append(cuts, cut{item.Start, item.End})
+		}
+	}
+	return cuts
+}
+
+// keepSegments returns the ranges of the stream around the cuts, or nil when
+// there is no stream or nothing to cut.
+func keepSegments(show Show, cuts []cut) []segment {
 	if len(show.Streams) == 0 {
 		return nil
 	}
@@ -31,13 +73,9 @@ func contentSegments(show Show) []segment {
 		return nil
 	}
 
-	type interval struct{ start, end int64 }
-	var cuts []interval
-	for _, item := range show.Items {
-		if !removeTypes[item.Type] {
-			continue
-		}
-		s, e := item.Start, item.End
+	var clipped []cut
+	for _, c := range cuts {
+		s, e := c.start, c.end
 		if s < streamStart {
 			s = streamStart
 		}
@@ -45,16 +83,16 @@ func contentSegments(show Show) []segment {
 			e = streamEnd
 		}
 		if e > s {
-			cuts = append(cuts, interval{s, e})
+			clipped = append(clipped, cut{s, e})
 		}
 	}
-	if len(cuts) == 0 {
+	if len(clipped) == 0 {
 		return nil
 	}
 
-	sort.Slice(cuts, func(i, j int) bool { return cuts[i].start < cuts[j].start })
-	merged := cuts[:1]
-	for _, c := range cuts[1:] {
+	sort.Slice(clipped, func(i, j int) bool { return clipped[i].start < clipped[j].start })
+	merged := clipped[:1]
+	for _, c := range clipped[1:] {
 		last := &merged[len(merged)-1]
 		if c.start <= last.end {
 			if c.end > last.end {
@@ -4,7 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
 )
@@ -20,33 +20,61 @@ var soundUrlPattern = regexp.MustCompile(`^https?://sound\.orf\.at/radio/fm4/sen
 var programKeyPattern = regexp.MustCompile(`^[0-9A-Z]{2,8}$`)
 
 // ResolveBroadcastUrls resolves a show reference into the broadcast href URLs
-// of all its episodes still inside the 30-day on-demand window. The reference
-// is either a sound.orf.at Sendung URL (which points at a single episode whose
-// programKey is resolved first) or a bare, stable programKey (e.g. "4DD").
-func ResolveBroadcastUrls(showRef string) []string {
+// of its selected episodes still inside the 30-day on-demand window. The
+// reference is either a sound.orf.at Sendung URL (which points at a single
+// episode whose programKey is resolved first) or a bare, stable programKey
+// (e.g. "4DD"). With selection.onlyThisEpisode a Sendung URL (or broadcast
+// id) stands for just its episode.
+func ResolveBroadcastUrls(showRef string, selection episodeSelection) []string {
+	if selection.onlyThisEpisode {
+		href, ok := broadcastHref(showRef)
+		if !ok {
+			fatalf("-only-this-episode expects a sound.orf.at Sendung URL or a broadcast id, got: %s", showRef)
+		}
+		return []string{href}
+	}
+
+	programKey, ok := programKeyFromRef(showRef)
+	if !ok {
+		fatalf("expected a sound.orf.at Sendung URL "+
+			"('https://sound.orf.at/radio/fm4/sendung/<id>[/<slug>]') or a programKey "+
+			"(e.g. '4DD'), got: %s", showRef)
+	}
+	return getProgramEpisodes(programKey, selection)
+}
+
+// programKeyFromRef returns the programKey of a show reference given as a
+// sound.orf.at Sendung URL or a bare programKey. ok is false for anything else
+// (e.g. a show name, which needs a search to resolve).
+func programKeyFromRef(showRef string) (programKey string, ok bool) {
 	if matches := soundUrlPattern.FindStringSubmatch(showRef); matches != nil {
 		broadcastId := matches[1]
 		programKey := getProgramKey(broadcastId)
-		log.Printf("Resolved show with programKey %s from URL", programKey)
-		log.Println("Found following show:")
-		return getProgramEpisodes(programKey)
+		slog.Info("Resolved show from URL", "programKey", programKey)
+		return programKey, true
 	}
 
 	if programKeyPattern.MatchString(showRef) {
-		log.Printf("Using programKey %s directly", showRef)
-		log.Println("Found following show:")
-		return getProgramEpisodes(showRef)
+		slog.Info("Using programKey directly", "programKey", showRef)
+		return showRef, true
 	}
 
-	log.Fatalf("expected a sound.orf.at Sendung URL "+
-		"('https://sound.orf.at/radio/fm4/sendung/<id>[/<slug>]') or a programKey "+
-		"(e.g. '4DD'), got: %s", showRef)
-	return nil
+	return "", false
+}
+
+// resolveShowRef is programKeyFromRef extended by a search for anything that is
+// neither a URL nor a programKey, so show names are accepted as well.
+// Returns "" when no show matches.
+func resolveShowRef(showRef string) string {
+	if programKey, ok := programKeyFromRef(showRef); ok {
+		return programKey
+	}
+	return ResolveProgramKey(showRef)
 }
 
 func logUnexpectedStatus(response *http.Response, url string) {
 	if response.StatusCode != http.StatusOK {
-		log.Fatalf("GET %s returned %s", url, response.Status)
+		fatal("Unexpected response status", "url", url, "status", response.Status)
 	}
 }
 
@@ -87,7 +115,34 @@ func getProgramKey(broadcastId string) string {
 // The episode list summaries omit stream URLs and items (those are only present
 // on the per-episode broadcast/{id} response), so a follow-up fetch per episode
 // is still required - the existing one-fetch-per-broadcast pattern is unchanged.
-func getProgramEpisodes(programKey string) []string {
+func getProgramEpisodes(programKey string, selection episodeSelection) []string {
+	episodes := getProgramBroadcasts(programKey)
+
+	if len(episodes) == 0 {
+		slog.Warn("No episodes found for this show.", "programKey", programKey)
+		return nil
+	}
+	episodes = selection.apply(episodes)
+	if len(episodes) == 0 {
+		slog.Warn("No episodes match the selection.", "programKey", programKey)
+		return nil
+	}
+
+	var urls []string
+	for _, episode := range episodes {
+		slog.Info("Found episode",
+			"title", episode.Title,
+			"programKey", episode.ProgramKey,
+			"broadcastDay", episode.BroadcastDay,
+			"href", episode.Href)
+		urls = append(urls, episode.Href)
+	}
+	return urls
+}
+
+// getProgramBroadcasts fetches broadcasts/program/{programKey} on the v5.0 API
+// and returns the episode list summaries in API order.
+func getProgramBroadcasts(programKey string) []broadcastSummary {
 	url := fmt.Sprintf("https://audioapi.orf.at/fm4/api/json/5.0/broadcasts/program/%s", programKey)
 
 	response, err := http.Get(url)
@@ -105,31 +160,14 @@ func getProgramEpisodes(programKey string) []string {
 
 	// The endpoint returns {"timezoneOffset": ..., "payload": [ <broadcast>, ... ]}
 	var wrapper struct {
-		Payload []struct {
-			Href         string `json:"href"`
-			ID           int    `json:"id"`
-			BroadcastDay int    `json:"broadcastDay"`
-			Title        string `json:"title"`
-			ProgramKey   string `json:"programKey"`
-		} `json:"payload"`
+		Payload []broadcastV5 `json:"payload"`
 	}
 	err = json.Unmarshal(responseData, &wrapper)
 	logError(err)
 
-	if len(wrapper.Payload) == 0 {
-		log.Println("No episodes found for this show.")
-		return nil
-	}
-
-	var urls []string
+	episodes := make([]broadcastSummary, 0, len(wrapper.Payload))
 	for _, episode := range wrapper.Payload {
-		log.Println("")
-		log.Printf("Name:            %s", episode.Title)
-		log.Printf("ProgramKey:      %s", episode.ProgramKey)
-		log.Printf("BroadcastDay:    %d", episode.BroadcastDay)
-		log.Printf("Href:            %s", episode.Href)
-		urls = append(urls, episode.Href)
+		episodes = append(episodes, episode.toSummary())
 	}
-	log.Println("")
-	return urls
+	return episodes
 }
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/jarcoal/httpmock"
 )
@@ -32,7 +33,7 @@ func TestResolveBroadcastUrlsFromSoundUrl(t *testing.T) {
 		},
 	)
 
-	got := ResolveBroadcastUrls(soundUrlDavidecks)
+	got := ResolveBroadcastUrls(soundUrlDavidecks, episodeSelection{})
 	want := []string{
 		"https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628",
 		"https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42536",
@@ -55,7 +56,7 @@ func TestResolveBroadcastUrlsFromProgramKey(t *testing.T) {
 		},
 	)
 
-	got := ResolveBroadcastUrls("4DD")
+	got := ResolveBroadcastUrls("4DD", episodeSelection{})
 	want := []string{
 		"https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628",
 		"https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42536",
@@ -65,6 +66,43 @@ func TestResolveBroadcastUrlsFromProgramKey(t *testing.T) {
 	}
 }
 
+func TestResolveBroadcastUrlsWithSelection(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	programUrl := "https://audioapi.orf.at/fm4/api/json/5.0/broadcasts/program/4DD"
+	httpmock.RegisterResponder("GET", programUrl,
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/program_4DD.json"))
+		},
+	)
+
+	newest := "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628"
+	older := "https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42536"
+	tests := []struct {
+		name      string
+		ref       string
+		selection episodeSelection
+		want      []string
+	}{
+		{"date", "4DD", episodeSelection{filter: broadcastFilter{Since: 20260613, Until: 20260613}}, []string{older}},
+		{"since", "4DD", episodeSelection{filter: broadcastFilter{Since: 20260614}}, []string{newest}},
+		{"latest", "4DD", episodeSelection{latest: 1}, []string{newest}},
+		{"weekday", "4DD", episodeSelection{filter: broadcastFilter{Weekdays: []time.Weekday{time.Saturday}}}, []string{newest, older}},
+		{"other weekday", "4DD", episodeSelection{filter: broadcastFilter{Weekdays: []time.Weekday{time.Sunday}}}, nil},
+		{"only this episode", soundUrlDavidecks, episodeSelection{onlyThisEpisode: true}, []string{newest}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResolveBroadcastUrls(tt.ref, tt.selection); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+	if calls := httpmock.GetCallCountInfo()["GET "+programUrl]; calls != len(tests)-1 {
+		t.Errorf("expected -only-this-episode not to list the program, got %d calls", calls)
+	}
+}
+
 func TestResolveBroadcastUrlsFromSoundUrlWithoutSlug(t *testing.T) {
 	httpmock.Activate()
 	defer httpmock.DeactivateAndReset()
@@ -83,7 +121,7 @@ func TestResolveBroadcastUrlsFromSoundUrlWithoutSlug(t *testing.T) {
 	)
 
 	// A Sound Sendung URL without the trailing title slug must also resolve.
-	got := ResolveBroadcastUrls("https://sound.orf.at/radio/fm4/sendung/42628")
+	got := ResolveBroadcastUrls("https://sound.orf.at/radio/fm4/sendung/42628", episodeSelection{})
 	if len(got) != 2 {
 		t.Errorf("expected 2 broadcast URLs, got %d (%q)", len(got), got)
 	}
@@ -146,7 +184,7 @@ func TestGetProgramEpisodes(t *testing.T) {
 		},
 	)
 
-	got := getProgramEpisodes("4DD")
+	got := getProgramEpisodes("4DD", episodeSelection{})
 	want := []string{
 		"https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42628",
 		"https://audioapi.orf.at/fm4/api/json/5.0/broadcast/42536",
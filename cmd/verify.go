@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bogem/id3v2"
+)
+
+// verifyResult is a file of the archive that failed verification.
+type verifyResult struct {
+	Path     string   `json:"path"`
+	Kind     string   `json:"kind"` // episode, cover or sidecar
+	Problems []string `json:"problems"`
+	// Action is what -redownload did about a broken episode.
+	Action string `json:"action,omitempty"`
+}
+
+// Outcomes of -redownload.
+const (
+	actionRedownloaded = "redownloaded"
+	actionUnavailable  = "unavailable"
+	actionFailed       = "redownload-failed"
+)
+
+func (r verifyResult) resolved() bool {
+	return r.Action == actionRedownloaded
+}
+
+type verifyOptions struct {
+	format     string
+	redownload bool
+	download   downloadOptions
+}
+
+// sidecarPattern matches the sidecar files of episodes, Title_YYYYMMDD.json.
+var sidecarPattern = regexp.MustCompile(`_\d{8}\.json$`)
+
+// Verify checks every episode below destDir and prints the problems found.
+// With opts.redownload, broken episodes still in the on-demand window are
+// downloaded again. Exits with status 1 if problems remain.
+func Verify(destDir string, opts verifyOptions) {
+	results, checked := verifyArchive(destDir)
+	if opts.redownload {
+		results = redownloadBroken(results, destDir, opts.download)
+	}
+
+	err := printVerifyResults(os.Stdout, results, opts.format)
+	logError(err)
+
+	unresolved := 0
+	for _, r := range results {
+		if !r.resolved() {
+			unresolved++
+		}
+	}
+	slog.Info("Verified archive", "episodes", checked, "problems", len(results), "unresolved", unresolved)
+	if unresolved > 0 {
+		exit(1)
+	}
+}
+
+// verifyArchive walks destDir and returns the broken episodes, orphaned covers
+// and orphaned sidecars, plus the number of episodes checked.
+func verifyArchive(destDir string) ([]verifyResult, int) {
+	var results []verifyResult
+	checked := 0
+	err := filepath.WalkDir(destDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		switch {
+		case strings.HasSuffix(path, ".mp3"):
+			checked++
+			if problems := verifyEpisode(path); len(problems) > 0 {
+				results = append(results, verifyResult{Path: path, Kind: "episode", Problems: problems})
+			}
+		case d.Name() == "cover.jpg":
+			if mp3s, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.mp3")); len(mp3s) == 0 {
+				results = append(results, verifyResult{Path: path, Kind: "cover", Problems: []string{"orphaned, no episode in its directory"}})
+			}
+		case sidecarPattern.MatchString(d.Name()):
+			exists, err := fileExists(strings.TrimSuffix(path, ".json") + ".mp3")
+			if err != nil {
+				return err
+			}
+			if !exists {
+				results = append(results, verifyResult{Path: path, Kind: "sidecar", Problems: []string{"orphaned, its episode is missing"}})
+			}
+		}
+		return nil
+	})
+	logError(err)
+	return results, checked
+}
+
+// verifyEpisode returns the problems of an archived mp3: frames that don't
+// parse or decode, missing tags, a missing cover the sidecar recorded and a
+// size or checksum differing from the ones the sidecar recorded.
+func verifyEpisode(path string) []string {
+	var problems []string
+
+	if scan, err := scanFrames(path); err != nil {
+		problems = append(problems, "unreadable: "+err.Error())
+	} else {
+		problems = append(problems, scan.problems()...)
+	}
+	if err := decodeAll(path); err != nil {
+		problems = append(problems, "does not decode: "+err.Error())
+	}
+	tagged, hasCover := tagProblems(path)
+	problems = append(problems, tagged...)
+
+	data, err := os.ReadFile(sidecarPath(path))
+	if errors.Is(err, os.ErrNotExist) {
+		if !hasCover {
+			// Shows without images are archived without a cover, so only
+			// the sidecar can tell whether one is missing.
+			slog.Warn("No embedded cover", "path", path)
+		}
+		return problems
+	}
+	var metadata episodeMetadata
+	if err == nil {
+		err = json.Unmarshal(data, &metadata)
+	}
+	if err != nil {
+		return append(problems, "unreadable sidecar: "+err.Error())
+	}
+	if !hasCover && metadata.Cover != "" {
+		problems = append(problems, "no embedded cover")
+	}
+	if metadata.SHA256 == "" {
+		return problems
+	}
+	size, sum, err := checksum(path)
+	switch {
+	case err != nil:
+		problems = append(problems, "checksum: "+err.Error())
+	case size != metadata.Size:
+		problems = append(problems, fmt.Sprintf("size %d bytes, recorded %d", size, metadata.Size))
+	case sum != metadata.SHA256:
+		problems = append(problems, "checksum differs from the recorded one")
+	}
+	return problems
+}
+
+func decodeAll(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	decoder, err := newPcmDecoder(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, decoder)
+	return err
+}
+
+// tagProblems checks for the frames writeId3Tag sets and reports whether a
+// cover is embedded.
+func tagProblems(path string) ([]string, bool) {
+	tag, err := id3v2.Open(path, id3v2.Options{Parse: true})
+	if err != nil {
+		return []string{"unreadable tag: " + err.Error()}, false
+	}
+	defer tag.Close()
+
+	var missing []string
+	for name, value := range map[string]string{
+		"title":        tag.Title(),
+		"album":        tag.Album(),
+		"artist":       tag.Artist(),
+		"year":         tag.Year(),
+		"album artist": tag.GetTextFrame("TPE2").Text,
+	} {
+		if value == "" {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	var problems []string
+	if len(missing) > 0 {
+		problems = append(problems, "missing tags "+strings.Join(missing, ", "))
+	}
+	return problems, len(tag.GetFrames(tag.CommonID("Attached picture"))) > 0
+}
+
+// frameScan is the outcome of walking the MPEG audio frames of a file.
+type frameScan struct {
+	frames int
+	// garbage counts the bytes that are neither a frame nor a tag, starting
+	// at firstGarbage.
+	garbage      int64
+	firstGarbage int64
+	// truncated is set if the file ends inside a frame.
+	truncated bool
+	// audioStart and audioEnd are the offsets of the first frame and of the
+	// end of the last complete one.
+	audioStart, audioEnd int64
+}
+
+func (s frameScan) problems() []string {
+	var problems []string
+	if s.frames == 0 {
+		problems = append(problems, "no mp3 frames")
+	}
+	if s.garbage > 0 {
+		problems = append(problems, fmt.Sprintf("%d bytes of garbage, first at offset %d", s.garbage, s.firstGarbage))
+	}
+	if s.truncated {
+		problems = append(problems, "last frame truncated")
+	}
+	return problems
+}
+
+// scanFrames walks the file frame by frame. go-mp3 silently skips what it
+// can't decode, so this is what finds truncated and overwritten files.
+func scanFrames(path string) (frameScan, error) {
+	var scan frameScan
+	file, err := os.Open(path)
+	if err != nil {
+		return scan, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return scan, err
+	}
+	r := bufio.NewReaderSize(file, 64*1024)
+
+	var offset int64
+	skip := func(n int64) error {
+		skipped, err := r.Discard(int(n))
+		offset += int64(skipped)
+		return err
+	}
+
+	if header, err := r.Peek(10); err == nil {
+		if err := skip(id3v2Size(header)); err != nil {
+			return scan, nil
+		}
+	}
+
+	for {
+		header, err := r.Peek(4)
+		if len(header) < 4 {
+			if len(header) > 0 {
+				scan.truncated = true
+			}
+			return scan, nil
+		}
+		if err != nil {
+			return scan, err
+		}
+		// An ID3v1 tag trails.
+		if string(header[:3]) == "TAG" && info.Size()-offset == 128 {
+			return scan, nil
+		}
+		length, _ := frameHeader(header)
+		// Frame syncs occur in audio data too: a frame counts only if
+		// another one, a tag or the end of the file follows.
+		if next, _ := r.Peek(length + 4); length > 0 && len(next) == length+4 {
+			if following, _ := frameHeader(next[length:]); following == 0 && string(next[length:length+3]) != "TAG" {
+				length = 0
+			}
+		}
+		if length == 0 {
+			if scan.garbage == 0 {
+				scan.firstGarbage = offset
+			}
+			scan.garbage++
+			if err := skip(1); err != nil {
+				return scan, err
+			}
+			continue
+		}
+		if scan.frames == 0 {
+			scan.audioStart = offset
+		}
+		if err := skip(int64(length)); err != nil {
+			scan.truncated = true
+			return scan, nil
+		}
+		scan.frames++
+		scan.audioEnd = offset
+	}
+}
+
+// Bitrates in kbit/s by bitrate index, for MPEG-1 layers I to III and MPEG-2
+// and 2.5 layer I and layers II/III.
+var frameBitrates = [5][16]int{
+	{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+}
+
+// Sample rates in Hz by sample rate index, for MPEG-1, 2 and 2.5.
+var frameSampleRates = [3][3]int{
+	{44100, 48000, 32000},
+	{22050, 24000, 16000},
+	{11025, 12000, 8000},
+}
+
+// id3v2Size returns the size of the ID3v2 tag starting with the 10 byte
+// header, or 0 if there is none.
+func id3v2Size(header []byte) int64 {
+	if string(header[:3]) != "ID3" {
+		return 0
+	}
+	// The size is syncsafe, 7 bits per byte.
+	size := 10 + (int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9]))
+	if header[5]&0x10 != 0 {
+		size += 10 // footer
+	}
+	return size
+}
+
+// frameHeader returns the length in bytes and the bitrate in bit/s of the
+// MPEG audio frame starting with header, or 0, 0 if header is not a valid
+// frame header. Free format frames count as invalid.
+func frameHeader(header []byte) (length, bitrate int) {
+	if header[0] != 0xFF || header[1]&0xE0 != 0xE0 {
+		return 0, 0
+	}
+	version := header[1] >> 3 & 3 // 0: 2.5, 2: 2, 3: 1
+	layer := header[1] >> 1 & 3   // 1: III, 2: II, 3: I
+	bitrateIndex := header[2] >> 4
+	rateIndex := header[2] >> 2 & 3
+	padding := int(header[2] >> 1 & 1)
+	if version == 1 || layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return 0, 0
+	}
+
+	mpeg1 := version == 3
+	sampleRate := frameSampleRates[map[byte]int{3: 0, 2: 1, 0: 2}[version]][rateIndex]
+	table := 4
+	switch {
+	case mpeg1:
+		table = int(3 - layer)
+	case layer == 3:
+		table = 3
+	}
+	bitrate = frameBitrates[table][bitrateIndex] * 1000
+
+	switch {
+	case layer == 3:
+		length = (12*bitrate/sampleRate + padding) * 4
+	case layer == 1 && !mpeg1:
+		length = 72*bitrate/sampleRate + padding
+	default:
+		length = 144*bitrate/sampleRate + padding
+	}
+	return length, bitrate
+}
+
+// frameDuration returns the playing time in milliseconds of the frame starting
+// with header, 0 if it is no frame header.
+func frameDuration(header []byte) float64 {
+	if length, _ := frameHeader(header); length == 0 {
+		return 0
+	}
+	version := header[1] >> 3 & 3
+	layer := header[1] >> 1 & 3
+	sampleRate := frameSampleRates[map[byte]int{3: 0, 2: 1, 0: 2}[version]][header[2]>>2&3]
+	samples := 1152
+	switch {
+	case layer == 3:
+		samples = 384
+	case layer == 1 && version != 3:
+		samples = 576
+	}
+	return float64(samples) * 1000 / float64(sampleRate)
+}
+
+// redownloadBroken downloads the broken episodes again that are still in the
+// on-demand window. The broken file is kept as .broken until its replacement
+// is written, and restored if the run is aborted before that.
+func redownloadBroken(results []verifyResult, destDir string, opts downloadOptions) []verifyResult {
+	programs := map[string][]broadcastSummary{}
+	var hrefs []string
+	var redownloaded []int
+	defer func(hooks []func()) { exitHooks = hooks }(exitHooks)
+	exitHooks = append(exitHooks, func() {
+		for _, i := range redownloaded {
+			path := results[i].Path
+			if exists, err := fileExists(path); err == nil && !exists {
+				slog.Warn("Aborted before the broken episode was replaced, restoring it", "path", path)
+				_ = os.Rename(path+".broken", path)
+			}
+		}
+	})
+	for i, r := range results {
+		if r.Kind != "episode" {
+			continue
+		}
+		programKey := programKeyOf(r.Path)
+		if programKey == "" {
+			slog.Warn("Cannot tell the show of the broken episode, skipping it", "path", r.Path)
+			results[i].Action = actionUnavailable
+			continue
+		}
+		if _, ok := programs[programKey]; !ok {
+			programs[programKey] = getProgramBroadcasts(programKey)
+		}
+		href := ""
+		for _, b := range programs[programKey] {
+			if b.BroadcastDay == broadcastDayOf(r.Path) {
+				href = b.Href
+			}
+		}
+		if href == "" {
+			slog.Warn("Broken episode is no longer available on demand", "path", r.Path)
+			results[i].Action = actionUnavailable
+			continue
+		}
+		logError(os.Rename(r.Path, r.Path+".broken"))
+		hrefs = append(hrefs, href)
+		redownloaded = append(redownloaded, i)
+	}
+	if len(hrefs) == 0 {
+		return results
+	}
+
+	downloadBroadcasts(hrefs, destDir, opts)
+
+	for _, i := range redownloaded {
+		path := results[i].Path
+		exists, err := fileExists(path)
+		logError(err)
+		if !exists {
+			slog.Error("Re-download did not replace the broken episode, restoring it", "path", path)
+			logError(os.Rename(path+".broken", path))
+			results[i].Action = actionFailed
+			continue
+		}
+		logError(os.Remove(path + ".broken"))
+		if problems := verifyEpisode(path); len(problems) > 0 {
+			results[i].Problems = problems
+			results[i].Action = actionFailed
+		} else {
+			results[i].Action = actionRedownloaded
+		}
+	}
+	return results
+}
+
+// programKeyOf returns the programKey of an archived episode, read from its
+// sidecar or else looked up by the name of its show directory without asking,
+// as verify runs unattended. Returns "" if the show is ambiguous.
+func programKeyOf(path string) string {
+	var metadata episodeMetadata
+	if data, err := os.ReadFile(sidecarPath(path)); err == nil && json.Unmarshal(data, &metadata) == nil && metadata.ProgramKey != "" {
+		return metadata.ProgramKey
+	}
+	show := filepath.Base(filepath.Dir(filepath.Dir(path)))
+	return lookupProgramKey(strings.ReplaceAll(show, "_", " "))
+}
+
+func printVerifyResults(w io.Writer, results []verifyResult, format string) error {
+	switch format {
+	case "", "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "KIND\tACTION\tPATH\tPROBLEMS")
+		for _, r := range results {
+			action := r.Action
+			if action == "" {
+				action = "-"
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Kind, action, r.Path, strings.Join(r.Problems, "; "))
+		}
+		return tw.Flush()
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if results == nil {
+			results = []verifyResult{}
+		}
+		return enc.Encode(results)
+	default:
+		return fmt.Errorf("unknown format %q, expected table or json", format)
+	}
+}
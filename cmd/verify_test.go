@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bogem/id3v2"
+	"github.com/jarcoal/httpmock"
+)
+
+func TestScanFrames(t *testing.T) {
+	data := httpmock.File("../_testdata/show.mp3").Bytes()
+	write := func(data []byte) string {
+		file := path.Join(t.TempDir(), "episode.mp3")
+		if err := os.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"intact", data, ""},
+		{"concatenated", append(append([]byte{}, data...), data...), ""},
+		{"truncated", data[:len(data)/2+17], "last frame truncated"},
+		{"overwritten", append(append(append([]byte{}, data[:40000]...), bytes.Repeat([]byte{0x55}, 5000)...), data[45000:]...), "garbage"},
+		{"empty", nil, "no mp3 frames"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scan, err := scanFrames(write(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Join(scan.problems(), "; ")
+			if tt.want == "" && got != "" || !strings.Contains(got, tt.want) {
+				t.Errorf("got %q want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	broadcastUrl := registerDavidecksDownload()
+	httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/5.0/broadcasts/program/4DD",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/program_4DD.json"))
+		},
+	)
+	defer func() { exit = os.Exit }()
+	code := 0
+	exit = func(c int) { code = c }
+
+	destDir := t.TempDir()
+	opts := downloadOptions{sidecar: true}
+	downloadBroadcasts([]string{broadcastUrl}, destDir, opts)
+	if results, checked := verifyArchive(destDir); checked != 1 || len(results) != 0 {
+		t.Fatalf("expected a clean archive, got %d checked and %+v", checked, results)
+	}
+
+	episode := path.Join(destDir, "Davidecks", "2026", "Davidecks_20260620.mp3")
+	data, err := os.ReadFile(episode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(data[len(data)/2:], bytes.Repeat([]byte{0x55}, 2000))
+	if err := os.WriteFile(episode, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	orphanDir := path.Join(destDir, "Davidecks", "2025")
+	if err := os.MkdirAll(orphanDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"cover.jpg", "Davidecks_20251227.json"} {
+		if err := os.WriteFile(path.Join(orphanDir, name), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A later run must not record the corruption as the good checksum.
+	downloadBroadcasts([]string{broadcastUrl}, destDir, opts)
+
+	results, _ := verifyArchive(destDir)
+	kinds := map[string]verifyResult{}
+	for _, r := range results {
+		kinds[r.Kind] = r
+	}
+	if len(results) != 3 || len(kinds) != 3 {
+		t.Fatalf("expected a broken episode and two orphans, got %+v", results)
+	}
+	if problems := strings.Join(kinds["episode"].Problems, "; "); !strings.Contains(problems, "garbage") || !strings.Contains(problems, "checksum differs") {
+		t.Errorf("unexpected problems %q", problems)
+	}
+
+	Verify(destDir, verifyOptions{format: "json", redownload: true, download: opts})
+	if code != 1 {
+		t.Errorf("expected exit status 1 for the remaining orphans, got %d", code)
+	}
+	if problems := verifyEpisode(episode); len(problems) > 0 {
+		t.Errorf("expected the episode to be repaired, got %v", problems)
+	}
+	if _, err := os.Stat(episode + ".broken"); !os.IsNotExist(err) {
+		t.Errorf("expected the broken copy to be removed, got %v", err)
+	}
+}
+
+func TestVerifyMissingCover(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	broadcastUrl := registerDavidecksDownload()
+
+	destDir := t.TempDir()
+	downloadBroadcasts([]string{broadcastUrl}, destDir, downloadOptions{sidecar: true})
+	episode := path.Join(destDir, "Davidecks", "2026", "Davidecks_20260620.mp3")
+
+	tag, err := id3v2.Open(episode, id3v2.Options{Parse: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag.DeleteFrames(tag.CommonID("Attached picture"))
+	if err := tag.Save(); err != nil {
+		t.Fatal(err)
+	}
+	_ = tag.Close()
+	var metadata episodeMetadata
+	readJson(t, sidecarPath(episode), &metadata)
+	if metadata.Size, metadata.SHA256, err = checksum(episode); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cover := range []string{metadata.Cover, ""} {
+		metadata.Cover = cover
+		data, _ := json.Marshal(metadata)
+		if err := os.WriteFile(sidecarPath(episode), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		problems := verifyEpisode(episode)
+		switch {
+		case cover != "" && !reflect.DeepEqual(problems, []string{"no embedded cover"}):
+			t.Errorf("expected the recorded cover to be missed, got %v", problems)
+		case cover == "" && len(problems) > 0:
+			t.Errorf("expected a show without images to be fine, got %v", problems)
+		}
+	}
+}
+
+func TestRedownloadAbortedRestoresBroken(t *testing.T) {
+	httpmock.Activate()
+	defer httpmock.DeactivateAndReset()
+	broadcastUrl := registerDavidecksDownload()
+	httpmock.RegisterResponder("GET", "https://audioapi.orf.at/fm4/api/json/5.0/broadcasts/program/4DD",
+		func(req *http.Request) (*http.Response, error) {
+			return httpmock.NewJsonResponse(200, httpmock.File("../_testdata/program_4DD.json"))
+		},
+	)
+
+	destDir := t.TempDir()
+	opts := downloadOptions{sidecar: true}
+	downloadBroadcasts([]string{broadcastUrl}, destDir, opts)
+	episode := path.Join(destDir, "Davidecks", "2026", "Davidecks_20260620.mp3")
+	data, err := os.ReadFile(episode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	copy(data[len(data)/2:], bytes.Repeat([]byte{0x55}, 2000))
+	if err := os.WriteFile(episode, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	httpmock.RegisterResponder("GET", broadcastUrl+"?items=1000", httpmock.NewStringResponder(500, ""))
+	if ok := runOnce(func() { Verify(destDir, verifyOptions{format: "json", redownload: true, download: opts}) }); ok {
+		t.Fatal("expected the re-download to abort")
+	}
+	if restored, err := os.ReadFile(episode); err != nil || !bytes.Equal(restored, data) {
+		t.Errorf("expected the broken episode to be restored, got %v", err)
+	}
+	if _, err := os.Stat(episode + ".broken"); !os.IsNotExist(err) {
+		t.Errorf("expected no .broken copy to be left, got %v", err)
+	}
+}